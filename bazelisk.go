@@ -30,6 +30,13 @@ func main() {
 	// Fetch LTS releases & candidates, rolling releases and Bazel-at-commits from GCS, forks from GitHub.
 	repos := core.CreateRepositories(gcs, gitHub, gcs, gcs, true)
 
+	if ok, err := core.PrintConfigIfRequested(os.Args[1:], config, os.Stdout); ok {
+		if err != nil {
+			log.Fatal(err)
+		}
+		os.Exit(0)
+	}
+
 	exitCode, err := core.RunBazeliskWithArgsFuncAndConfig(func(string) []string { return os.Args[1:] }, repos, config)
 	if err != nil {
 		log.Fatal(err)
@@ -1,17 +1,22 @@
 package main
 
 import (
+	"context"
+	"crypto/sha256"
 	"encoding/json"
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
 	"slices"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/bazelbuild/bazelisk/config"
 	"github.com/bazelbuild/bazelisk/core"
 	"github.com/bazelbuild/bazelisk/httputil"
+	"github.com/bazelbuild/bazelisk/platforms"
 	"github.com/bazelbuild/bazelisk/repositories"
 	"github.com/bazelbuild/bazelisk/versions"
 )
@@ -53,7 +58,7 @@ func TestResolveVersion(t *testing.T) {
 
 	gcs := &repositories.GCSRepo{}
 	repos := core.CreateRepositories(gcs, nil, nil, nil, false)
-	version, _, err := repos.ResolveVersion(tmpDir, versions.BazelUpstream, "4.0.0", config.Null())
+	version, _, err := repos.ResolveVersion(context.Background(), tmpDir, versions.BazelUpstream, "4.0.0", config.Null())
 
 	if err != nil {
 		t.Fatalf("Version resolution failed unexpectedly: %v", err)
@@ -71,7 +76,7 @@ func TestResolvePatchVersion(t *testing.T) {
 
 	gcs := &repositories.GCSRepo{}
 	repos := core.CreateRepositories(gcs, nil, nil, nil, false)
-	version, _, err := repos.ResolveVersion(tmpDir, versions.BazelUpstream, "4.0.0-patch1", config.Null())
+	version, _, err := repos.ResolveVersion(context.Background(), tmpDir, versions.BazelUpstream, "4.0.0-patch1", config.Null())
 
 	if err != nil {
 		t.Fatalf("Version resolution failed unexpectedly: %v", err)
@@ -93,7 +98,7 @@ func TestResolveLatestRcVersion(t *testing.T) {
 
 	gcs := &repositories.GCSRepo{}
 	repos := core.CreateRepositories(gcs, nil, nil, nil, false)
-	version, _, err := repos.ResolveVersion(tmpDir, versions.BazelUpstream, "last_rc", config.Null())
+	version, _, err := repos.ResolveVersion(context.Background(), tmpDir, versions.BazelUpstream, "last_rc", config.Null())
 
 	if err != nil {
 		t.Fatalf("Version resolution failed unexpectedly: %v", err)
@@ -111,7 +116,7 @@ func TestResolveLatestRcVersion_WithFullRelease(t *testing.T) {
 
 	gcs := &repositories.GCSRepo{}
 	repos := core.CreateRepositories(gcs, nil, nil, nil, false)
-	version, _, err := repos.ResolveVersion(tmpDir, versions.BazelUpstream, "last_rc", config.Null())
+	version, _, err := repos.ResolveVersion(context.Background(), tmpDir, versions.BazelUpstream, "last_rc", config.Null())
 
 	if err != nil {
 		t.Fatalf("Version resolution failed unexpectedly: %v", err)
@@ -131,7 +136,7 @@ func TestResolveLatestVersion_TwoLatestVersionsDoNotHaveAReleaseYet(t *testing.T
 
 	gcs := &repositories.GCSRepo{}
 	repos := core.CreateRepositories(gcs, nil, nil, nil, false)
-	version, _, err := repos.ResolveVersion(tmpDir, versions.BazelUpstream, "latest", config.Null())
+	version, _, err := repos.ResolveVersion(context.Background(), tmpDir, versions.BazelUpstream, "latest", config.Null())
 
 	if err != nil {
 		t.Fatalf("Version resolution failed unexpectedly: %v", err)
@@ -142,6 +147,38 @@ func TestResolveLatestVersion_TwoLatestVersionsDoNotHaveAReleaseYet(t *testing.T
 	}
 }
 
+func TestResolveLatestVersion_IgnoresListingTTL(t *testing.T) {
+	home := t.TempDir()
+	resolveLatest := func() string {
+		gcs := &repositories.GCSRepo{}
+		repos := core.CreateRepositories(gcs, nil, nil, nil, false)
+		version, _, err := repos.ResolveVersion(context.Background(), home, versions.BazelUpstream, "latest", config.Null())
+		if err != nil {
+			t.Fatalf("Version resolution failed unexpectedly: %v", err)
+		}
+		return version
+	}
+
+	s := setUp(t)
+	httputil.ListingTTL = time.Hour
+	defer func() { httputil.ListingTTL = 0 }()
+	s.AddVersion("4.0.0", true, nil, nil)
+	s.Finish()
+	if version := resolveLatest(); version != "4.0.0" {
+		t.Fatalf("Expected version 4.0.0, but got %s", version)
+	}
+
+	// GCS listings are always revalidated, so a new release is visible right away.
+	s = setUp(t)
+	httputil.ListingTTL = time.Hour
+	s.AddVersion("4.0.0", true, nil, nil)
+	s.AddVersion("5.0.0", true, nil, nil)
+	s.Finish()
+	if version := resolveLatest(); version != "5.0.0" {
+		t.Fatalf("Expected version 5.0.0, but got %s", version)
+	}
+}
+
 func TestResolveLatestVersion_ShouldOnlyReturnStableReleases(t *testing.T) {
 	s := setUp(t)
 	s.AddVersion("3.0.0", true, []int{1}, nil)
@@ -153,7 +190,7 @@ func TestResolveLatestVersion_ShouldOnlyReturnStableReleases(t *testing.T) {
 
 	gcs := &repositories.GCSRepo{}
 	repos := core.CreateRepositories(gcs, nil, nil, nil, false)
-	version, _, err := repos.ResolveVersion(tmpDir, versions.BazelUpstream, "latest-1", config.Null())
+	version, _, err := repos.ResolveVersion(context.Background(), tmpDir, versions.BazelUpstream, "latest-1", config.Null())
 
 	if err != nil {
 		t.Fatalf("Version resolution failed unexpectedly: %v", err)
@@ -194,7 +231,7 @@ func TestResolveLatestAvoidsUnnecessaryRequests(t *testing.T) {
 
 		gcs := &repositories.GCSRepo{}
 		repos := core.CreateRepositories(gcs, nil, nil, nil, false)
-		gotVersion, _, err := repos.ResolveVersion(tmpDir, versions.BazelUpstream, test.specifiedVersion, config.Null())
+		gotVersion, _, err := repos.ResolveVersion(context.Background(), tmpDir, versions.BazelUpstream, test.specifiedVersion, config.Null())
 
 		if err != nil {
 			t.Fatalf("Version resolution failed unexpectedly: %v", err)
@@ -209,8 +246,9 @@ func TestResolveLatestAvoidsUnnecessaryRequests(t *testing.T) {
 		- One to check for the existence of the 7.* release (candidates), which returns a match
 		*/
 		wantRequests := 3
-		if gotRequests := len(s.Transport.RequestedURLs); gotRequests != wantRequests {
-			t.Errorf("Expected exactly %d requests (one for the top-level, one for 8.0.0, one for 7.0.0), but got %d:\n%s", wantRequests, gotRequests, strings.Join(s.Transport.RequestedURLs, "\n"))
+		requests := s.Transport.Requests()
+		if gotRequests := len(requests); gotRequests != wantRequests {
+			t.Errorf("Expected exactly %d requests (one for the top-level, one for 8.0.0, one for 7.0.0), but got %d:\n%s", wantRequests, gotRequests, strings.Join(requests, "\n"))
 		}
 	})
 	}
@@ -224,7 +262,7 @@ func TestResolveLatestVersion_ShouldFailIfNotEnoughReleases(t *testing.T) {
 
 	gcs := &repositories.GCSRepo{}
 	repos := core.CreateRepositories(gcs, nil, nil, nil, false)
-	_, _, err := repos.ResolveVersion(tmpDir, versions.BazelUpstream, "latest-1", config.Null())
+	_, _, err := repos.ResolveVersion(context.Background(), tmpDir, versions.BazelUpstream, "latest-1", config.Null())
 
 	if err == nil {
 		t.Fatal("Expected ResolveVersion() to fail.")
@@ -241,7 +279,7 @@ func TestResolveLatestVersion_GCSIsDown(t *testing.T) {
 
 	gcs := &repositories.GCSRepo{}
 	repos := core.CreateRepositories(gcs, nil, nil, nil, false)
-	_, _, err := repos.ResolveVersion(tmpDir, versions.BazelUpstream, "latest", config.Null())
+	_, _, err := repos.ResolveVersion(context.Background(), tmpDir, versions.BazelUpstream, "latest", config.Null())
 
 	if err == nil {
 		t.Fatal("Expected resolveLatestVersion() to fail.")
@@ -259,7 +297,7 @@ func TestResolveLatestVersion_GitHubIsDown(t *testing.T) {
 	gh := repositories.CreateGitHubRepo("test_token")
 	repos := core.CreateRepositories(nil, gh, nil, nil, false)
 
-	_, _, err := repos.ResolveVersion(tmpDir, "some_fork", "latest", config.Null())
+	_, _, err := repos.ResolveVersion(context.Background(), tmpDir, "some_fork", "latest", config.Null())
 
 	if err == nil {
 		t.Fatal("Expected resolveLatestVersion() to fail.")
@@ -270,12 +308,113 @@ func TestResolveLatestVersion_GitHubIsDown(t *testing.T) {
 	}
 }
 
+func TestDownloadForkFromReleaseAssets(t *testing.T) {
+	filename, err := platforms.DetermineBazelFilename("1.2.3", true, config.Null())
+	if err != nil {
+		t.Fatalf("Could not determine Bazel filename: %v", err)
+	}
+	binary := "fake_bazel_binary"
+	assetURL := "https://api.github.com/repos/asset_fork/bazel/releases/assets/1"
+	checksumURL := "https://api.github.com/repos/asset_fork/bazel/releases/assets/2"
+
+	tests := []struct {
+		name     string
+		checksum string
+		wantErr  string
+	}{
+		{
+			name:     "ChecksumMatches",
+			checksum: fmt.Sprintf("%x  %s\n", sha256.Sum256([]byte(binary)), filename),
+		},
+		{
+			name:     "ChecksumMismatch",
+			checksum: fmt.Sprintf("%x  %s\n", sha256.Sum256([]byte("something else")), filename),
+			wantErr:  "but the release lists sha256=",
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fork := fmt.Sprintf("asset_fork_%d", i)
+			transport := installTransport()
+			releases := fmt.Sprintf(`[{"tag_name": "1.2.3", "prerelease": false, "assets": [{"name": %q, "url": %q}, {"name": %q, "url": %q}]}]`, filename, assetURL, filename+".sha256", checksumURL)
+			transport.AddResponse(fmt.Sprintf("https://api.github.com/repos/%s/bazel/releases", fork), 200, releases, nil)
+			transport.AddResponse(assetURL, 200, binary, nil)
+			transport.AddResponse(checksumURL, 200, test.checksum, nil)
+
+			gh := repositories.CreateGitHubRepo("test_token")
+			repos := core.CreateRepositories(nil, gh, nil, nil, false)
+			version, downloader, err := repos.ResolveVersion(context.Background(), tmpDir, fork, "latest", config.Null())
+			if err != nil {
+				t.Fatalf("Version resolution failed unexpectedly: %v", err)
+			}
+			if version != "1.2.3" {
+				t.Fatalf("Expected version 1.2.3, but got %s", version)
+			}
+
+			destDir := filepath.Join(tmpDir, test.name)
+			path, err := downloader(context.Background(), destDir, "bazel")
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("Expected error containing %q, but got %v", test.wantErr, err)
+				}
+				if _, err := os.Stat(filepath.Join(destDir, "bazel")); err == nil {
+					t.Errorf("Expected binary with invalid checksum to be removed")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Download failed unexpectedly: %v", err)
+			}
+			content, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("Could not read downloaded binary: %v", err)
+			}
+			if string(content) != binary {
+				t.Errorf("Expected binary content %q, but got %q", binary, content)
+			}
+			if requests := transport.Requests(); !slices.Contains(requests, assetURL) {
+				t.Errorf("Expected download via the asset API, but requested:\n%s", strings.Join(requests, "\n"))
+			}
+		})
+	}
+}
+
+func TestDownloadForkSendsGitHubToken(t *testing.T) {
+	filename, err := platforms.DetermineBazelFilename("1.2.3", true, config.Null())
+	if err != nil {
+		t.Fatalf("Could not determine Bazel filename: %v", err)
+	}
+	binary := "fake_bazel_binary"
+	assetURL := "https://api.github.com/repos/token_fork/bazel/releases/assets/1"
+	checksumURL := "https://api.github.com/repos/token_fork/bazel/releases/assets/2"
+	authenticated := map[string]string{"Authorization": "token test_token", "Accept": "application/octet-stream"}
+
+	// Requests without the token get a 404, like requests for assets of private repositories.
+	transport := installTransport()
+	releases := fmt.Sprintf(`[{"tag_name": "1.2.3", "prerelease": false, "assets": [{"name": %q, "url": %q}, {"name": %q, "url": %q}]}]`, filename, assetURL, filename+".sha256", checksumURL)
+	transport.AddMatchingResponse(httputil.RequestMatcher{URLPattern: "https://api.github.com/repos/token_fork/bazel/releases", Headers: map[string]string{"Authorization": "token test_token"}}, 200, releases, nil)
+	transport.AddMatchingResponse(httputil.RequestMatcher{URLPattern: assetURL, Headers: authenticated}, 200, binary, nil)
+	transport.AddMatchingResponse(httputil.RequestMatcher{URLPattern: checksumURL, Headers: authenticated}, 200, fmt.Sprintf("%x  %s\n", sha256.Sum256([]byte(binary)), filename), nil)
+
+	gh := repositories.CreateGitHubRepo("test_token")
+	repos := core.CreateRepositories(nil, gh, nil, nil, false)
+	_, downloader, err := repos.ResolveVersion(context.Background(), tmpDir, "token_fork", "latest", config.Null())
+	if err != nil {
+		t.Fatalf("Version resolution failed unexpectedly: %v", err)
+	}
+	if _, err := downloader(context.Background(), filepath.Join(tmpDir, t.Name()), "bazel"); err != nil {
+		t.Fatalf("Download failed unexpectedly: %v", err)
+	}
+	transport.AssertRequested(t, assetURL, checksumURL)
+}
+
 func TestAcceptRollingReleaseName(t *testing.T) {
 	gcs := &repositories.GCSRepo{}
 	repos := core.CreateRepositories(nil, nil, nil, gcs, false)
 
 	for _, version := range []string{"10.0.0-pre.20201103.4", "10.0.0-pre.20201103.4.2"} {
-		resolvedVersion, _, err := repos.ResolveVersion(tmpDir, "", version, config.Null())
+		resolvedVersion, _, err := repos.ResolveVersion(context.Background(), tmpDir, "", version, config.Null())
 
 		if err != nil {
 			t.Fatalf("ResolveVersion(%q, \"\", %q): expected no error, but got %v", tmpDir, version, err)
@@ -296,7 +435,7 @@ func TestResolveLatestRollingRelease(t *testing.T) {
 	gcs := &repositories.GCSRepo{}
 	repos := core.CreateRepositories(nil, nil, nil, gcs, false)
 
-	version, _, err := repos.ResolveVersion(tmpDir, "", rollingReleaseIdentifier, config.Null())
+	version, _, err := repos.ResolveVersion(context.Background(), tmpDir, "", rollingReleaseIdentifier, config.Null())
 
 	if err != nil {
 		t.Fatalf("ResolveVersion(%q, \"\", %q): expected no error, but got %v", tmpDir, rollingReleaseIdentifier, err)
@@ -339,6 +478,30 @@ func TestAcceptTrackBasedReleaseVersions(t *testing.T) {
 			releaseExists:    false,
 			wantVersion:      "4.2.1rc3",
 		},
+		{
+			name:             "MinorFloating_ReleaseExists",
+			requestedVersion: "4.2.x",
+			releaseExists:    true,
+			wantVersion:      "4.2.1",
+		},
+		{
+			name:             "MinorFloating_NoRelease",
+			requestedVersion: "4.2.x",
+			releaseExists:    false,
+			wantVersion:      "4.2.0",
+		},
+		{
+			name:             "MinorWildcard_NoRelease",
+			requestedVersion: "4.2.*",
+			releaseExists:    false,
+			wantVersion:      "4.2.1rc3",
+		},
+		{
+			name:             "MinorFloating_OlderMinor",
+			requestedVersion: "4.1.x",
+			releaseExists:    true,
+			wantVersion:      "4.1.0",
+		},
 	}
 
 	for _, test := range tests {
@@ -353,7 +516,7 @@ func TestAcceptTrackBasedReleaseVersions(t *testing.T) {
 
 			gcs := &repositories.GCSRepo{}
 			repos := core.CreateRepositories(gcs, nil, nil, nil, false)
-			version, _, err := repos.ResolveVersion(tmpDir, versions.BazelUpstream, test.requestedVersion, config.Null())
+			version, _, err := repos.ResolveVersion(context.Background(), tmpDir, versions.BazelUpstream, test.requestedVersion, config.Null())
 
 			if err != nil {
 				t.Fatalf("Version resolution failed unexpectedly: %v", err)
@@ -365,6 +528,150 @@ func TestAcceptTrackBasedReleaseVersions(t *testing.T) {
 	}
 }
 
+func TestResolveVersionConstraints(t *testing.T) {
+	tests := []struct {
+		requestedVersion string
+		wantVersion      string
+	}{
+		{requestedVersion: ">=4.1.0 <5", wantVersion: "4.2.0"},
+		{requestedVersion: ">= 4.1.0, < 4.2", wantVersion: "4.1.1"},
+		{requestedVersion: "~4.1", wantVersion: "4.1.1"},
+		{requestedVersion: "~4", wantVersion: "4.2.0"},
+		{requestedVersion: "^4.1", wantVersion: "4.2.0"},
+		{requestedVersion: "~>4.1.0", wantVersion: "4.1.1"},
+		{requestedVersion: ">4", wantVersion: "5.0.0"},
+		{requestedVersion: "!=5.0.0", wantVersion: "4.2.0"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.requestedVersion, func(t *testing.T) {
+			s := setUp(t)
+			s.AddVersion("4.0.0", true, nil, nil)
+			s.AddVersion("4.1.0", true, nil, nil)
+			s.AddVersion("4.1.1", true, nil, nil)
+			s.AddVersion("4.2.0", true, nil, nil)
+			s.AddVersion("4.2.1", false, []int{1}, nil)
+			s.AddVersion("5.0.0", true, nil, nil)
+			s.Finish()
+
+			gcs := &repositories.GCSRepo{}
+			repos := core.CreateRepositories(gcs, nil, nil, nil, false)
+			version, _, err := repos.ResolveVersion(context.Background(), tmpDir, versions.BazelUpstream, test.requestedVersion, config.Null())
+
+			if err != nil {
+				t.Fatalf("Version resolution failed unexpectedly: %v", err)
+			}
+			if version != test.wantVersion {
+				t.Fatalf("Expected version %s, but got %s", test.wantVersion, version)
+			}
+		})
+	}
+}
+
+func TestResolveVersionConstraintsSkipsNonMatchingVersions(t *testing.T) {
+	s := setUp(t)
+	s.AddVersion("6.0.0", true, nil, nil)
+	s.AddVersion("7.0.0", true, nil, nil)
+	s.AddVersion("7.1.0", true, nil, nil)
+	s.AddVersion("8.0.0", true, nil, nil)
+	s.Finish()
+
+	gcs := &repositories.GCSRepo{}
+	repos := core.CreateRepositories(gcs, nil, nil, nil, false)
+	version, _, err := repos.ResolveVersion(context.Background(), tmpDir, versions.BazelUpstream, "<7.1", config.Null())
+
+	if err != nil {
+		t.Fatalf("Version resolution failed unexpectedly: %v", err)
+	}
+	if version != "7.0.0" {
+		t.Fatalf("Expected version 7.0.0, but got %s", version)
+	}
+	// One request for the list of all versions and one for 7.0.0, but none for 8.0.0 and 7.1.0.
+	wantRequests := 2
+	requests := s.Transport.Requests()
+	if gotRequests := len(requests); gotRequests != wantRequests {
+		t.Errorf("Expected exactly %d requests, but got %d:\n%s", wantRequests, gotRequests, strings.Join(requests, "\n"))
+	}
+}
+
+func TestResolveVersionConstraintsWithoutMatch(t *testing.T) {
+	s := setUp(t)
+	s.AddVersion("7.0.0", true, nil, nil)
+	s.Finish()
+
+	gcs := &repositories.GCSRepo{}
+	repos := core.CreateRepositories(gcs, nil, nil, nil, false)
+	for _, requestedVersion := range []string{"^8", "~7.x", ">="} {
+		if _, _, err := repos.ResolveVersion(context.Background(), tmpDir, versions.BazelUpstream, requestedVersion, config.Null()); err == nil {
+			t.Errorf("Expected resolution of %q to fail", requestedVersion)
+		}
+	}
+}
+
+func TestMinorTrackAvoidsUnnecessaryRequests(t *testing.T) {
+	s := setUp(t)
+	s.AddVersion("7.2.0", true, nil, nil)
+	s.AddVersion("7.3.0", true, nil, nil)
+	s.AddVersion("7.3.1", true, nil, nil)
+	s.AddVersion("7.4.0", true, nil, nil)
+	s.AddVersion("8.0.0", true, nil, nil)
+	s.Finish()
+
+	gcs := &repositories.GCSRepo{}
+	repos := core.CreateRepositories(gcs, nil, nil, nil, false)
+	version, _, err := repos.ResolveVersion(context.Background(), tmpDir, versions.BazelUpstream, "7.3.x", config.Null())
+
+	if err != nil {
+		t.Fatalf("Version resolution failed unexpectedly: %v", err)
+	}
+	if version != "7.3.1" {
+		t.Fatalf("Expected version 7.3.1, but got %s", version)
+	}
+	// One request for the list of all versions and one for 7.3.1, but none for 8.0.0, 7.4.0 and older versions.
+	wantRequests := 2
+	requests := s.Transport.Requests()
+	if gotRequests := len(requests); gotRequests != wantRequests {
+		t.Errorf("Expected exactly %d requests, but got %d:\n%s", wantRequests, gotRequests, strings.Join(requests, "\n"))
+	}
+}
+
+func TestMinorTrackWithoutReleases(t *testing.T) {
+	s := setUp(t)
+	s.AddVersion("7.2.0", true, nil, nil)
+	s.AddVersion("7.4.0", true, nil, nil)
+	s.Finish()
+
+	gcs := &repositories.GCSRepo{}
+	repos := core.CreateRepositories(gcs, nil, nil, nil, false)
+	_, _, err := repos.ResolveVersion(context.Background(), tmpDir, versions.BazelUpstream, "7.3.x", config.Null())
+
+	if err == nil || !strings.Contains(err.Error(), "for track 7.3") {
+		t.Fatalf("Expected resolution to fail for track 7.3, but got %v", err)
+	}
+}
+
+func TestForkMinorTrack(t *testing.T) {
+	transport := installTransport()
+	releases := `[{"tag_name": "8.0.0"}, {"tag_name": "7.4.0"}, {"tag_name": "7.3.1"}, {"tag_name": "7.3.0"}, {"tag_name": "7.2.0"}]`
+	transport.AddResponse("https://api.github.com/repos/minor_track_fork/bazel/releases", 200, releases, nil)
+
+	gh := repositories.CreateGitHubRepo("test_token")
+	repos := core.CreateRepositories(nil, gh, nil, nil, false)
+	version, _, err := repos.ResolveVersion(context.Background(), tmpDir, "minor_track_fork", "7.3.x", config.Null())
+
+	if err != nil {
+		t.Fatalf("Version resolution failed unexpectedly: %v", err)
+	}
+	if version != "7.3.1" {
+		t.Fatalf("Expected version 7.3.1, but got %s", version)
+	}
+
+	_, _, err = repos.ResolveVersion(context.Background(), tmpDir, "minor_track_fork", "7.1.x", config.Null())
+	if err == nil {
+		t.Fatal("Expected resolution of 7.1.x to fail")
+	}
+}
+
 type gcsSetup struct {
 	baseURL         string
 	versionPrefixes []string
@@ -422,6 +729,8 @@ func setUp(t *testing.T) *gcsSetup {
 func installTransport() *httputil.FakeTransport {
 	ft := httputil.NewFakeTransport()
 	httputil.DefaultTransport = ft
+	// All tests share the same Bazelisk home, so cached listings must not be reused.
+	httputil.ListingTTL = 0
 	return ft
 }
 
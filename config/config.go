@@ -2,9 +2,10 @@
 package config
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
-	"strings"
+	"runtime"
 
 	"github.com/bazelbuild/bazelisk/ws"
 )
@@ -13,7 +14,11 @@ const rcFileName = ".bazeliskrc"
 
 // Config allows getting Bazelisk configuration values.
 type Config interface {
+	// Get returns the value of the config, or an empty string if it isn't set.
 	Get(name string) string
+	// Lookup returns the value of the config and whether it's set, which allows distinguishing explicitly empty
+	// values from unset ones, like os.LookupEnv.
+	Lookup(name string) (string, bool)
 }
 
 // FromEnv returns a Config which gets config values from environment variables.
@@ -27,52 +32,75 @@ func (c *fromEnv) Get(name string) string {
 	return os.Getenv(name)
 }
 
+func (c *fromEnv) Lookup(name string) (string, bool) {
+	return os.LookupEnv(name)
+}
+
+func (c *fromEnv) sources(name string) []Source {
+	if value, ok := c.Lookup(name); ok {
+		return []Source{{Value: value, Location: "environment"}}
+	}
+	return nil
+}
+
 // FromFile returns a Config which gets config values from a Bazelisk config file.
 func FromFile(path string) (Config, error) {
-	values, err := parseFileConfig(path)
+	c, err := parseFileConfig(path)
 	if err != nil {
 		return nil, err
 	}
-	return &static{
-		values: values,
-	}, nil
+	return c, nil
 }
 
 type static struct {
 	values map[string]string
+	// origins contains the location of each key in a config file, if the values were read from one.
+	origins map[string]string
+	// warnings contains the problems in the config file that did not prevent reading it.
+	warnings []string
 }
 
 func (c *static) Get(name string) string {
 	return c.values[name]
 }
 
-// parseFileConfig parses a .bazeliskrc file as a map of key-value configuration values.
-func parseFileConfig(rcFilePath string) (map[string]string, error) {
-	config := make(map[string]string)
+func (c *static) Lookup(name string) (string, bool) {
+	value, ok := c.values[name]
+	return value, ok
+}
 
-	contents, err := os.ReadFile(rcFilePath)
-	if err != nil {
-		if os.IsNotExist(err) {
-			// Non-critical error.
-			return config, nil
-		}
-		return nil, err
+func (c *static) sources(name string) []Source {
+	if value, ok := c.Lookup(name); ok {
+		return []Source{{Value: value, Location: c.origins[name]}}
 	}
+	return nil
+}
 
-	for _, line := range strings.Split(string(contents), "\n") {
-		if strings.HasPrefix(line, "#") {
-			// comments
-			continue
-		}
-		parts := strings.SplitN(line, "=", 2)
-		if len(parts) < 2 {
-			continue
-		}
-		key := strings.TrimSpace(parts[0])
-		config[key] = strings.TrimSpace(parts[1])
+// LocateSystemConfigFile locates the system-wide bazeliskrc file, which is /etc/bazeliskrc on Unix and
+// %ProgramData%\bazelisk\bazeliskrc on Windows.
+func LocateSystemConfigFile() (string, error) {
+	if runtime.GOOS != "windows" {
+		return "/etc/bazeliskrc", nil
 	}
+	programData := os.Getenv("ProgramData")
+	if programData == "" {
+		return "", fmt.Errorf("%%ProgramData%% is not set")
+	}
+	return filepath.Join(programData, "bazelisk", "bazeliskrc"), nil
+}
 
-	return config, nil
+// LocateXDGConfigFile locates the bazeliskrc file in the user's config directory as defined by the XDG Base Directory
+// Specification, i.e. $XDG_CONFIG_HOME/bazelisk/bazeliskrc, which defaults to ~/.config/bazelisk/bazeliskrc.
+func LocateXDGConfigFile() (string, error) {
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if configHome == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		configHome = filepath.Join(home, ".config")
+	}
+	return filepath.Join(configHome, "bazelisk", "bazeliskrc"), nil
 }
 
 // LocateUserConfigFile locates a .bazeliskrc file in the user's home directory.
@@ -90,14 +118,73 @@ func LocateWorkspaceConfigFile() (string, error) {
 	if err != nil {
 		return "", err
 	}
+	return workspaceConfigFile(workingDirectory), nil
+}
+
+func workspaceConfigFile(workingDirectory string) string {
 	workspaceRoot := ws.FindWorkspaceRoot(workingDirectory)
 	if workspaceRoot == "" {
-		return "", err
+		return ""
 	}
-	return filepath.Join(workspaceRoot, rcFileName), nil
+	return filepath.Join(workspaceRoot, rcFileName)
+}
+
+// LocateDirectoryConfigFiles locates the .bazeliskrc files in the current directory and all of its parents below the
+// workspace root, starting with the current directory. Outside of a workspace there are no such files.
+func LocateDirectoryConfigFiles() ([]string, error) {
+	workingDirectory, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	return directoryConfigFiles(workingDirectory), nil
+}
+
+func directoryConfigFiles(workingDirectory string) []string {
+	workspaceRoot := ws.FindWorkspaceRoot(workingDirectory)
+	if workspaceRoot == "" {
+		return nil
+	}
+	var paths []string
+	for dir := workingDirectory; dir != workspaceRoot; dir = filepath.Dir(dir) {
+		paths = append(paths, filepath.Join(dir, rcFileName))
+	}
+	return paths
+}
+
+// LocateConfigFiles returns the paths of all config files in order of precedence, from highest to lowest:
+//   - the .bazeliskrc files between the current directory and the workspace root, nearest first
+//   - the .bazeliskrc file in the workspace root
+//   - the .bazeliskrc file in the user's home directory
+//   - the bazeliskrc file in the user's XDG config directory
+//   - the system-wide bazeliskrc file
+//
+// Locations that cannot be determined are skipped. The files don't necessarily exist.
+func LocateConfigFiles() []string {
+	return LocateConfigFilesIn("")
+}
+
+// LocateConfigFilesIn behaves like LocateConfigFiles, but looks for the workspace root and the per-directory files
+// relative to the given directory instead of the current one. Like Bazel, it treats every directory inside a
+// workspace as belonging to that workspace. An empty directory stands for the current one.
+func LocateConfigFilesIn(workingDirectory string) []string {
+	var paths []string
+	// filepath.Abs("") returns the current directory.
+	if dir, err := filepath.Abs(workingDirectory); err == nil {
+		paths = directoryConfigFiles(dir)
+		if path := workspaceConfigFile(dir); path != "" {
+			paths = append(paths, path)
+		}
+	}
+	for _, locate := range []func() (string, error){LocateUserConfigFile, LocateXDGConfigFile, LocateSystemConfigFile} {
+		if path, err := locate(); err == nil && path != "" {
+			paths = append(paths, path)
+		}
+	}
+	return paths
 }
 
 // Layered returns a Config which gets config values from the first of a series of other Config values which sets the config.
+// An explicitly empty value in one Config overrides the values in all subsequent ones.
 func Layered(configs ...Config) Config {
 	return &layered{
 		configs: configs,
@@ -108,13 +195,53 @@ type layered struct {
 	configs []Config
 }
 
+func (c *layered) sources(name string) []Source {
+	var result []Source
+	for _, config := range c.configs {
+		result = append(result, Sources(config, name)...)
+	}
+	return result
+}
+
 func (c *layered) Get(name string) string {
+	value, _ := c.Lookup(name)
+	return value
+}
+
+func (c *layered) Lookup(name string) (string, bool) {
 	for _, config := range c.configs {
-		if value := config.Get(name); value != "" {
-			return value
+		if value, ok := config.Lookup(name); ok {
+			return value, true
 		}
 	}
-	return ""
+	return "", false
+}
+
+// Source describes a value of a key and where it was set.
+type Source struct {
+	Value string `json:"value"`
+	// Location is "environment" for environment variables and "path:line" for config files.
+	// It is empty if the value comes from a Config that doesn't know its origin, such as Static.
+	Location string `json:"location,omitempty"`
+	// Key is the name of the platform-specific key that set the value, if any (see PlatformSpecific).
+	Key string `json:"key,omitempty"`
+}
+
+// sourcer is implemented by Configs that can report where their values come from.
+type sourcer interface {
+	sources(name string) []Source
+}
+
+// Sources returns all values of the key in the config, from highest to lowest precedence.
+// The first one is the effective value, which shadows all the others.
+func Sources(c Config, name string) []Source {
+	if s, ok := c.(sourcer); ok {
+		return s.sources(name)
+	}
+	if value, ok := c.Lookup(name); ok {
+		return []Source{{Value: value}}
+	}
+	return nil
 }
 
 // Null returns a Config with no config values.
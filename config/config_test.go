@@ -0,0 +1,143 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDirectoryConfigFiles(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "MODULE.bazel"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	nested := filepath.Join(root, "a", "b")
+	if err := os.MkdirAll(nested, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		dir  string
+		want []string
+	}{
+		{name: "nested", dir: nested, want: []string{filepath.Join(root, "a", "b", rcFileName), filepath.Join(root, "a", rcFileName)}},
+		{name: "workspace root", dir: root, want: nil},
+		{name: "outside of workspace", dir: t.TempDir(), want: nil},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := directoryConfigFiles(tc.dir)
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Expected %v, but got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestLocateXDGConfigFile(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", "/xdg")
+	got, err := LocateXDGConfigFile()
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if want := filepath.Join("/xdg", "bazelisk", "bazeliskrc"); got != want {
+		t.Errorf("Expected %q, but got %q", want, got)
+	}
+}
+
+func TestLayeredPrecedence(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, contents string) Config {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+		c, err := FromFile(path)
+		if err != nil {
+			t.Fatalf("Could not parse %s: %v", path, err)
+		}
+		return c
+	}
+	c := Layered(
+		write("nearest", "BAZELISK_NOJDK=1\n"),
+		write("workspace", "BAZELISK_NOJDK=0\nUSE_BAZEL_VERSION=7.0.0\n"),
+		write("system", "USE_BAZEL_VERSION=6.0.0\nBAZELISK_BASE_URL=https://mirror\n"),
+	)
+
+	for name, want := range map[string]string{
+		"BAZELISK_NOJDK":    "1",
+		"USE_BAZEL_VERSION": "7.0.0",
+		"BAZELISK_BASE_URL": "https://mirror",
+	} {
+		if got := c.Get(name); got != want {
+			t.Errorf("Expected %s=%q, but got %q", name, want, got)
+		}
+	}
+}
+
+func TestLayeredExplicitlyEmptyValue(t *testing.T) {
+	workspace := writeRcFile(t, t.TempDir(), ".bazeliskrc", "BAZELISK_SHUTDOWN=\nBAZELISK_BASE_URL=\"\"\n")
+	workspaceConfig, err := FromFile(workspace)
+	if err != nil {
+		t.Fatalf("Could not parse %s: %v", workspace, err)
+	}
+	c := Layered(
+		Static(map[string]string{"USE_BAZEL_VERSION": ""}),
+		workspaceConfig,
+		Static(map[string]string{"BAZELISK_SHUTDOWN": "1", "BAZELISK_BASE_URL": "https://mirror", "USE_BAZEL_VERSION": "7.0.0", "BAZELISK_NOJDK": "1"}),
+	)
+
+	tests := []struct {
+		name   string
+		value  string
+		wantOk bool
+	}{
+		{name: "BAZELISK_SHUTDOWN", value: "", wantOk: true},
+		{name: "BAZELISK_BASE_URL", value: "", wantOk: true},
+		{name: "USE_BAZEL_VERSION", value: "", wantOk: true},
+		{name: "BAZELISK_NOJDK", value: "1", wantOk: true},
+		{name: "BAZELISK_HOME", value: "", wantOk: false},
+	}
+	for _, tc := range tests {
+		value, ok := c.Lookup(tc.name)
+		if value != tc.value || ok != tc.wantOk {
+			t.Errorf("Expected Lookup(%s) = (%q, %v), but got (%q, %v)", tc.name, tc.value, tc.wantOk, value, ok)
+		}
+		if got := c.Get(tc.name); got != tc.value {
+			t.Errorf("Expected Get(%s) = %q, but got %q", tc.name, tc.value, got)
+		}
+	}
+}
+
+func TestFromEnvLookup(t *testing.T) {
+	t.Setenv("BAZELISK_TEST_EMPTY", "")
+	if value, ok := FromEnv().Lookup("BAZELISK_TEST_EMPTY"); value != "" || !ok {
+		t.Errorf("Expected an explicitly empty value, but got (%q, %v)", value, ok)
+	}
+	if _, ok := FromEnv().Lookup("BAZELISK_TEST_UNSET_VARIABLE"); ok {
+		t.Errorf("Expected an unset variable not to be found")
+	}
+}
+
+func TestIsEnabled(t *testing.T) {
+	c := Layered(
+		Static(map[string]string{"EMPTY": "", "ZERO": "0", "FALSE": "False", "NO": "no"}),
+		Static(map[string]string{"EMPTY": "1", "ONE": "1", "TRUE": "true", "OTHER": "anything"}),
+	)
+	for name, want := range map[string]bool{
+		"EMPTY": false,
+		"ZERO":  false,
+		"FALSE": false,
+		"NO":    false,
+		"UNSET": false,
+		"ONE":   true,
+		"TRUE":  true,
+		"OTHER": true,
+	} {
+		if got := IsEnabled(c, name); got != want {
+			t.Errorf("Expected IsEnabled(%s) = %v, but got %v", name, want, got)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package config
+
+import (
+	"runtime"
+	"strings"
+)
+
+var (
+	knownOperatingSystems = map[string]bool{"DARWIN": true, "FREEBSD": true, "LINUX": true, "NETBSD": true, "OPENBSD": true, "WINDOWS": true}
+	knownArchitectures    = map[string]bool{"386": true, "AMD64": true, "ARM": true, "ARM64": true, "PPC64LE": true, "RISCV64": true, "S390X": true}
+)
+
+// PlatformSpecific returns a Config in which every key can be overridden for the current platform by appending
+// the operating system and optionally the architecture to its name, e.g. BAZELISK_NOJDK_LINUX_ARM64 or
+// BAZELISK_NOJDK_LINUX. The names are the upper-case values of runtime.GOOS and runtime.GOARCH.
+// The most specific key takes precedence.
+func PlatformSpecific(c Config) Config {
+	return platformSpecificFor(c, runtime.GOOS, runtime.GOARCH)
+}
+
+func platformSpecificFor(c Config, goos, goarch string) Config {
+	osSuffix := "_" + strings.ToUpper(goos)
+	return &platformSpecific{
+		config:   c,
+		suffixes: []string{osSuffix + "_" + strings.ToUpper(goarch), osSuffix, ""},
+	}
+}
+
+type platformSpecific struct {
+	config Config
+	// suffixes contains the suffixes of the key names to check, from most to least specific.
+	suffixes []string
+}
+
+func (c *platformSpecific) Get(name string) string {
+	value, _ := c.Lookup(name)
+	return value
+}
+
+func (c *platformSpecific) Lookup(name string) (string, bool) {
+	name = c.baseName(name)
+	for _, suffix := range c.suffixes {
+		if value, ok := c.config.Lookup(name + suffix); ok {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+func (c *platformSpecific) sources(name string) []Source {
+	name = c.baseName(name)
+	var result []Source
+	for _, suffix := range c.suffixes {
+		for _, s := range Sources(c.config, name+suffix) {
+			if suffix != "" {
+				s.Key = name + suffix
+			}
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+// baseName removes the suffix of the current platform from the name, since e.g. BAZELISK_HOME_LINUX and BAZELISK_HOME
+// refer to the same setting on Linux. This way a layer that only sets BAZELISK_HOME still takes precedence over
+// BAZELISK_HOME_LINUX in a lower layer when the latter is looked up explicitly.
+func (c *platformSpecific) baseName(name string) string {
+	for _, suffix := range c.suffixes {
+		if base, ok := strings.CutSuffix(name, suffix); ok && suffix != "" && base != "" {
+			return base
+		}
+	}
+	return name
+}
+
+// trimPlatformSuffix returns the name without a platform suffix such as "_LINUX" or "_LINUX_ARM64".
+func trimPlatformSuffix(name string) string {
+	if i := strings.LastIndexByte(name, '_'); i >= 0 && knownArchitectures[name[i+1:]] {
+		if j := strings.LastIndexByte(name[:i], '_'); j >= 0 && knownOperatingSystems[name[j+1:i]] {
+			return name[:j]
+		}
+	}
+	if i := strings.LastIndexByte(name, '_'); i >= 0 && knownOperatingSystems[name[i+1:]] {
+		return name[:i]
+	}
+	return name
+}
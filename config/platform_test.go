@@ -0,0 +1,80 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPlatformSpecific(t *testing.T) {
+	env := platformSpecificFor(Static(map[string]string{
+		"BAZELISK_BASE_URL": "https://env",
+	}), "linux", "arm64")
+	file := platformSpecificFor(Static(map[string]string{
+		"BAZELISK_BASE_URL":              "https://file",
+		"BAZELISK_BASE_URL_LINUX":        "https://file-linux",
+		"BAZELISK_NOJDK":                 "0",
+		"BAZELISK_NOJDK_LINUX":           "1",
+		"BAZELISK_NOJDK_LINUX_ARM64":     "",
+		"USE_BAZEL_VERSION":              "7.0.0",
+		"USE_BAZEL_VERSION_DARWIN":       "6.0.0",
+		"USE_BAZEL_VERSION_LINUX_AMD64":  "5.0.0",
+		"BAZELISK_VERIFY_SHA256_WINDOWS": "abc",
+	}), "linux", "arm64")
+	c := Layered(env, file)
+
+	for name, want := range map[string]string{
+		// Higher layers take precedence over more specific keys.
+		"BAZELISK_BASE_URL": "https://env",
+		// The most specific key wins, even if it's empty.
+		"BAZELISK_NOJDK": "",
+		// Keys for other platforms are ignored.
+		"USE_BAZEL_VERSION":      "7.0.0",
+		"BAZELISK_VERIFY_SHA256": "",
+		// Keys for the current platform are resolved like the plain key.
+		"BAZELISK_BASE_URL_LINUX":    "https://env",
+		"BAZELISK_NOJDK_LINUX_ARM64": "",
+		"USE_BAZEL_VERSION_LINUX":    "7.0.0",
+		"USE_BAZEL_VERSION_DARWIN":   "6.0.0",
+	} {
+		if got := c.Get(name); got != want {
+			t.Errorf("Expected %s=%q, but got %q", name, want, got)
+		}
+	}
+
+	want := []Source{
+		{Value: "", Key: "BAZELISK_NOJDK_LINUX_ARM64"},
+		{Value: "1", Key: "BAZELISK_NOJDK_LINUX"},
+		{Value: "0"},
+	}
+	if got := Sources(c, "BAZELISK_NOJDK"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected sources %v, but got %v", want, got)
+	}
+}
+
+func TestTrimPlatformSuffix(t *testing.T) {
+	for name, want := range map[string]string{
+		"BAZELISK_NOJDK_LINUX_ARM64":   "BAZELISK_NOJDK",
+		"USE_BAZEL_VERSION_WINDOWS":    "USE_BAZEL_VERSION",
+		"BAZELISK_BASE_URL_AMD64":      "BAZELISK_BASE_URL_AMD64",
+		"BAZELISK_DOWNLOAD_LOCK_DIR":   "BAZELISK_DOWNLOAD_LOCK_DIR",
+		"BAZELISK_HOME_DARWIN_ARM64":   "BAZELISK_HOME",
+		"USE_BAZEL_VERSION_LINUX_MIPS": "USE_BAZEL_VERSION_LINUX_MIPS",
+	} {
+		if got := trimPlatformSuffix(name); got != want {
+			t.Errorf("Expected trimPlatformSuffix(%s) = %s, but got %s", name, want, got)
+		}
+	}
+}
+
+func TestCheckAcceptsPlatformSpecificKeys(t *testing.T) {
+	path := writeRcFile(t, t.TempDir(), ".bazeliskrc", "BAZELISK_NOJDK_LINUX_ARM64=1\nUSE_BAZEL_VERSION_MACOS=7.0.0\n")
+	file, err := FromFile(path)
+	if err != nil {
+		t.Fatalf("Could not parse %s: %v", path, err)
+	}
+
+	want := []string{path + ":2: unknown key USE_BAZEL_VERSION_MACOS"}
+	if got := Check(Layered(PlatformSpecific(file))); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected warnings %q, but got %q", want, got)
+	}
+}
@@ -0,0 +1,240 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// parseFileConfig parses a .bazeliskrc file as a map of key-value configuration values.
+// A missing file is not an error.
+//
+// The syntax is a subset of shell syntax, so that the file can also be sourced by a shell:
+//   - Empty lines and lines starting with "#" are ignored.
+//   - Each other line is KEY=VALUE, optionally prefixed with "export".
+//   - Values can be quoted. Single quotes keep the value verbatim, while double quotes allow escaping with "\".
+//   - ${VAR} and $VAR in values are replaced with the value of an earlier key in the file, or the environment variable.
+//   - Unquoted " #" starts a comment.
+//
+// In addition, "import PATH" and "try-import PATH" read another file at that point, with relative paths being
+// resolved relative to the importing file. try-import ignores missing files.
+//
+// Lines that are not KEY=VALUE or whose value is malformed are skipped with a warning, since older versions of
+// Bazelisk silently ignored them. Only errors in imports, such as a missing file, fail the parsing.
+//
+// The returned config also knows the location ("path:line") at which each key was set.
+func parseFileConfig(rcFilePath string) (*static, error) {
+	p := &rcParser{
+		values:  make(map[string]string),
+		origins: make(map[string]string),
+		active:  make(map[string]bool),
+	}
+	if err := p.parseFile(rcFilePath, true); err != nil {
+		return nil, err
+	}
+	return &static{values: p.values, origins: p.origins, warnings: p.warnings}, nil
+}
+
+type rcParser struct {
+	values  map[string]string
+	origins map[string]string
+	// warnings contains the lines that were skipped, prefixed with their location.
+	warnings []string
+	// active contains the files that are currently being parsed, in order to detect import cycles.
+	active map[string]bool
+}
+
+func (p *rcParser) parseFile(path string, optional bool) error {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		if optional && os.IsNotExist(err) {
+			// Non-critical error.
+			return nil
+		}
+		return err
+	}
+
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	if p.active[absPath] {
+		return fmt.Errorf("%s imports itself", path)
+	}
+	p.active[absPath] = true
+	defer delete(p.active, absPath)
+
+	for i, line := range strings.Split(string(contents), "\n") {
+		location := fmt.Sprintf("%s:%d", path, i+1)
+		if err := p.parseLine(path, location, strings.TrimSpace(line)); err != nil {
+			return fmt.Errorf("%s: %v", location, err)
+		}
+	}
+	return nil
+}
+
+func (p *rcParser) parseLine(path, location, line string) error {
+	if line == "" || strings.HasPrefix(line, "#") {
+		return nil
+	}
+
+	if directive, arg := cutWord(line); directive == "import" || directive == "try-import" {
+		importPath, err := p.parseValue(arg)
+		if err != nil {
+			return err
+		}
+		if importPath == "" {
+			return fmt.Errorf("%s requires a path", directive)
+		}
+		if !filepath.IsAbs(importPath) {
+			importPath = filepath.Join(filepath.Dir(path), importPath)
+		}
+		return p.parseFile(importPath, directive == "try-import")
+	}
+
+	if word, rest := cutWord(line); word == "export" {
+		line = rest
+	}
+	key, rawValue, ok := strings.Cut(line, "=")
+	if !ok {
+		p.warn(location, "ignoring line %q, expected KEY=VALUE", line)
+		return nil
+	}
+	key = strings.TrimSpace(key)
+	if !isName(key) {
+		p.warn(location, "ignoring invalid key %q", key)
+		return nil
+	}
+	value, err := p.parseValue(strings.TrimSpace(rawValue))
+	if err != nil {
+		p.warn(location, "ignoring invalid value of %s: %v", key, err)
+		return nil
+	}
+	p.values[key] = value
+	p.origins[key] = location
+	return nil
+}
+
+func (p *rcParser) warn(location, format string, args ...interface{}) {
+	p.warnings = append(p.warnings, location+": "+fmt.Sprintf(format, args...))
+}
+
+// parseValue removes quotes, expands variables and strips comments.
+func (p *rcParser) parseValue(raw string) (string, error) {
+	var sb strings.Builder
+	// Trailing whitespace before a comment is only removed if it isn't quoted.
+	quotedLength := 0
+	for i := 0; i < len(raw); {
+		switch c := raw[i]; {
+		case c == '\'':
+			end := strings.IndexByte(raw[i+1:], '\'')
+			if end < 0 {
+				return "", fmt.Errorf("unterminated single quote")
+			}
+			sb.WriteString(raw[i+1 : i+1+end])
+			i += end + 2
+			quotedLength = sb.Len()
+		case c == '"':
+			i++
+			for {
+				if i >= len(raw) {
+					return "", fmt.Errorf("unterminated double quote")
+				}
+				if raw[i] == '"' {
+					i++
+					break
+				}
+				if raw[i] == '\\' && i+1 < len(raw) && strings.IndexByte(`"\$`, raw[i+1]) >= 0 {
+					sb.WriteByte(raw[i+1])
+					i += 2
+					continue
+				}
+				if raw[i] == '$' {
+					n, err := p.expand(raw[i:], &sb)
+					if err != nil {
+						return "", err
+					}
+					i += n
+					continue
+				}
+				sb.WriteByte(raw[i])
+				i++
+			}
+			quotedLength = sb.Len()
+		case c == '#' && i > 0 && (raw[i-1] == ' ' || raw[i-1] == '\t'):
+			value := sb.String()
+			return value[:quotedLength] + strings.TrimRight(value[quotedLength:], " \t"), nil
+		case c == '$':
+			n, err := p.expand(raw[i:], &sb)
+			if err != nil {
+				return "", err
+			}
+			i += n
+		default:
+			sb.WriteByte(c)
+			i++
+		}
+	}
+	return sb.String(), nil
+}
+
+// expand writes the value of the variable reference at the start of s and returns the length of the reference.
+// A "$" that isn't followed by a name is kept as is.
+func (p *rcParser) expand(s string, sb *strings.Builder) (int, error) {
+	var name string
+	var length int
+	if strings.HasPrefix(s, "${") {
+		end := strings.IndexByte(s, '}')
+		if end < 0 {
+			return 0, fmt.Errorf("unterminated ${")
+		}
+		name = s[2:end]
+		if !isName(name) {
+			return 0, fmt.Errorf("invalid variable name %q", name)
+		}
+		length = end + 1
+	} else {
+		length = 1
+		for length < len(s) && isNameChar(s[length], length == 1) {
+			length++
+		}
+		if length == 1 {
+			sb.WriteByte('$')
+			return 1, nil
+		}
+		name = s[1:length]
+	}
+
+	if value, ok := p.values[name]; ok {
+		sb.WriteString(value)
+	} else {
+		sb.WriteString(os.Getenv(name))
+	}
+	return length, nil
+}
+
+// cutWord splits the line at the first whitespace.
+func cutWord(line string) (string, string) {
+	i := strings.IndexAny(line, " \t")
+	if i < 0 {
+		return line, ""
+	}
+	return line[:i], strings.TrimSpace(line[i+1:])
+}
+
+func isName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !isNameChar(s[i], i == 0) {
+			return false
+		}
+	}
+	return true
+}
+
+func isNameChar(c byte, first bool) bool {
+	return c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || !first && '0' <= c && c <= '9'
+}
@@ -0,0 +1,156 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeRcFile(t *testing.T, dir, name, contents string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestParseFileConfig(t *testing.T) {
+	t.Setenv("BAZELISK_TEST_MIRROR", "https://mirror.example.com")
+
+	tests := []struct {
+		name     string
+		contents string
+		want     map[string]string
+	}{
+		{
+			name:     "plain",
+			contents: "USE_BAZEL_VERSION=7.0.0\n\n# comment\n  # indented comment\nBAZELISK_NOJDK = 1 \r\n",
+			want:     map[string]string{"USE_BAZEL_VERSION": "7.0.0", "BAZELISK_NOJDK": "1"},
+		},
+		{
+			name:     "export",
+			contents: "export USE_BAZEL_VERSION=7.0.0\n",
+			want:     map[string]string{"USE_BAZEL_VERSION": "7.0.0"},
+		},
+		{
+			name:     "quotes",
+			contents: `A="with trailing space "` + "\n" + `B='$NOT_EXPANDED # no comment'` + "\n" + `C="escaped \" and \$"` + "\n" + `D=a"b c"'d'` + "\n",
+			want:     map[string]string{"A": "with trailing space ", "B": "$NOT_EXPANDED # no comment", "C": `escaped " and $`, "D": "ab cd"},
+		},
+		{
+			name:     "comments",
+			contents: "A=value # comment\nB=url#fragment\nC=\"quoted \" # comment\n",
+			want:     map[string]string{"A": "value", "B": "url#fragment", "C": "quoted "},
+		},
+		{
+			name:     "expansion",
+			contents: "BAZELISK_BASE_URL=${BAZELISK_TEST_MIRROR}/bazel\nA=$BAZELISK_BASE_URL/x\nB=\"${A}-$\"\nC=${UNDEFINED_BAZELISK_TEST_VARIABLE}\n",
+			want: map[string]string{
+				"BAZELISK_BASE_URL": "https://mirror.example.com/bazel",
+				"A":                 "https://mirror.example.com/bazel/x",
+				"B":                 "https://mirror.example.com/bazel/x-$",
+				"C":                 "",
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			path := writeRcFile(t, t.TempDir(), ".bazeliskrc", tc.contents)
+			got, err := parseFileConfig(path)
+			if err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			if !reflect.DeepEqual(got.values, tc.want) {
+				t.Errorf("Expected %v, but got %v", tc.want, got.values)
+			}
+		})
+	}
+}
+
+func TestParseFileConfigErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+		want     string
+	}{
+		{name: "missing import", contents: "import missing.rc\n", want: "missing.rc"},
+		{name: "import without path", contents: "import\n", want: ":1: import requires a path"},
+		{name: "import cycle", contents: "import .bazeliskrc\n", want: "imports itself"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			path := writeRcFile(t, t.TempDir(), ".bazeliskrc", tc.contents)
+			_, err := parseFileConfig(path)
+			if err == nil {
+				t.Fatalf("Expected error containing %q, but got none", tc.want)
+			}
+			if !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("Expected error containing %q, but got %q", tc.want, err)
+			}
+		})
+	}
+}
+
+func TestParseFileConfigWarnings(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+		want     string
+	}{
+		{name: "missing equals sign", contents: "BAZELISK_NOJDK=1\nUSE_BAZEL_VERSION\n", want: `:2: ignoring line "USE_BAZEL_VERSION", expected KEY=VALUE`},
+		{name: "invalid key", contents: "MY-KEY=1\n", want: `:1: ignoring invalid key "MY-KEY"`},
+		{name: "unterminated quote", contents: "A=\"abc\n", want: ":1: ignoring invalid value of A: unterminated double quote"},
+		{name: "unterminated variable", contents: "\n\nA=${B\n", want: ":3: ignoring invalid value of A: unterminated ${"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			path := writeRcFile(t, t.TempDir(), ".bazeliskrc", tc.contents+"USE_BAZEL_VERSION=7.0.0\n")
+			c, err := parseFileConfig(path)
+			if err != nil {
+				t.Fatalf("Expected the line to be skipped, but got %v", err)
+			}
+			if got := c.Get("USE_BAZEL_VERSION"); got != "7.0.0" {
+				t.Errorf("Expected the other lines to be read, but got USE_BAZEL_VERSION=%q", got)
+			}
+			if warnings := Check(c); len(warnings) != 1 || !strings.HasSuffix(warnings[0], tc.want) {
+				t.Errorf("Expected a warning ending with %q, but got %q", tc.want, warnings)
+			}
+		})
+	}
+}
+
+func TestParseFileConfigImports(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "tools"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeRcFile(t, dir, filepath.Join("tools", "shared.rc"), "USE_BAZEL_VERSION=7.0.0\nBAZELISK_NOJDK=1\n")
+	path := writeRcFile(t, dir, ".bazeliskrc", "BAZELISK_BASE_URL=https://mirror\nimport tools/shared.rc\ntry-import \"user.rc\"\nBAZELISK_NOJDK=0\nA=$USE_BAZEL_VERSION\n")
+
+	c, err := parseFileConfig(path)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	got, origins := c.values, c.origins
+	wantOrigins := map[string]string{
+		"BAZELISK_BASE_URL": path + ":1",
+		"USE_BAZEL_VERSION": filepath.Join(dir, "tools", "shared.rc") + ":1",
+		"BAZELISK_NOJDK":    path + ":4",
+		"A":                 path + ":5",
+	}
+	if !reflect.DeepEqual(origins, wantOrigins) {
+		t.Errorf("Expected origins %v, but got %v", wantOrigins, origins)
+	}
+	want := map[string]string{
+		"BAZELISK_BASE_URL": "https://mirror",
+		"USE_BAZEL_VERSION": "7.0.0",
+		"BAZELISK_NOJDK":    "0",
+		"A":                 "7.0.0",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, but got %v", want, got)
+	}
+}
@@ -0,0 +1,296 @@
+package config
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bazelbuild/bazelisk/versions"
+)
+
+// Type describes the format of a config value.
+type Type int
+
+const (
+	// String values are arbitrary text.
+	String Type = iota
+	// Bool values are "1", "true" or "yes" to enable a setting and "0", "false" or "no" to disable it.
+	Bool
+	// Int values are decimal integers.
+	Int
+	// Duration values are parsed by time.ParseDuration, e.g. "30s" or "1h".
+	Duration
+	// Path values are file system paths.
+	Path
+	// URL values are absolute URLs.
+	URL
+	// FormatURL values are absolute URLs that may contain the placeholders of BAZELISK_FORMAT_URL, e.g. %v.
+	FormatURL
+	// SHA256 values are hex-encoded SHA-256 digests.
+	SHA256
+	// VersionLabel values are Bazel version labels such as "7.1.0", "latest", ">=7.1.0 <8" or "fork/7.x",
+	// or paths to a Bazel binary that are absolute or start with "~/".
+	VersionLabel
+	// Secret values contain credentials, which must not be displayed.
+	Secret
+)
+
+var typeNames = map[Type]string{
+	String:       "string",
+	Bool:         "bool",
+	Int:          "int",
+	Duration:     "duration",
+	Path:         "path",
+	URL:          "URL",
+	FormatURL:    "URL template",
+	SHA256:       "sha256",
+	VersionLabel: "version label",
+	Secret:       "secret",
+}
+
+func (t Type) String() string {
+	return typeNames[t]
+}
+
+// Validate returns an error if the value doesn't have the format of the type.
+func (t Type) Validate(value string) error {
+	switch t {
+	case Bool:
+		switch strings.ToLower(value) {
+		case "1", "0", "true", "false", "yes", "no":
+			return nil
+		}
+		return fmt.Errorf("must be one of 1, true, yes, 0, false or no")
+	case Int:
+		if _, err := strconv.Atoi(value); err != nil {
+			return fmt.Errorf("must be an integer")
+		}
+	case Duration:
+		if _, err := time.ParseDuration(value); err != nil {
+			return fmt.Errorf("must be a duration such as 30s or 1h")
+		}
+	case URL:
+		if u, err := url.Parse(value); err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("must be an absolute URL")
+		}
+	case FormatURL:
+		var b strings.Builder
+		for i := 0; i < len(value); i++ {
+			if value[i] != '%' {
+				b.WriteByte(value[i])
+				continue
+			}
+			i++
+			if i == len(value) || !strings.ContainsRune("ehmov%", rune(value[i])) {
+				return fmt.Errorf("must only contain the placeholders %%e, %%h, %%m, %%o, %%v and %%%%")
+			}
+			// Substitute the placeholders with text that is valid in every part of a URL.
+			b.WriteString("x")
+		}
+		return URL.Validate(b.String())
+	case SHA256:
+		if b, err := hex.DecodeString(value); err != nil || len(b) != 32 {
+			return fmt.Errorf("must be a SHA-256 digest with 64 hexadecimal digits")
+		}
+	case VersionLabel:
+		// Only "~" and "~/..." are paths, whereas "~7.2" is a version constraint.
+		if filepath.IsAbs(value) || value == "~" || strings.HasPrefix(value, "~/") || strings.HasPrefix(value, "~"+string(filepath.Separator)) {
+			return nil
+		}
+		parts := strings.Split(value, "/")
+		// Only version constraints such as ">=7.1.0 <8" may contain whitespace.
+		if strings.ContainsAny(value, " \t") && strings.IndexAny(parts[len(parts)-1], "<>=!~^") != 0 {
+			return fmt.Errorf("must not contain whitespace")
+		}
+		if len(parts) > 2 || parts[0] == "" || parts[len(parts)-1] == "" {
+			return fmt.Errorf("must be a version, optionally prefixed with a fork name and a slash")
+		}
+		fork := versions.BazelUpstream
+		if len(parts) == 2 {
+			fork = parts[0]
+		}
+		if _, err := versions.Parse(fork, parts[len(parts)-1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// IsEnabled returns whether the config enables the boolean setting with the given name.
+// Unset and empty values as well as "0", "false" and "no" disable the setting, while any other value enables it.
+func IsEnabled(c Config, name string) bool {
+	value, ok := c.Lookup(name)
+	if !ok {
+		return false
+	}
+	switch strings.ToLower(value) {
+	case "", "0", "false", "no":
+		return false
+	}
+	return true
+}
+
+// Key describes a config value that Bazelisk understands.
+type Key struct {
+	Name        string
+	Type        Type
+	Description string
+}
+
+// Schema contains all keys that Bazelisk understands, sorted by name.
+var Schema = []Key{
+	{"BAZELISK_BASE_URL", URL, "Base URL from which Bazel binaries are downloaded instead of GitHub."},
+	{"BAZELISK_CA_BUNDLE", Path, "PEM file with CA certificates that are trusted in addition to the system certificates."},
+	{"BAZELISK_CLEAN", Bool, "Run `clean --expunge` between builds when migrating or bisecting."},
+	{"BAZELISK_CLIENT_CERT", Path, "PEM file with a TLS client certificate."},
+	{"BAZELISK_CLIENT_KEY", Path, "PEM file with the private key of the TLS client certificate."},
+	{"BAZELISK_CONNECT_TIMEOUT", Duration, "Maximum time to establish a connection."},
+	{"BAZELISK_CREDENTIAL_HELPER", Path, "Credential helper that provides headers for download requests."},
+	{"BAZELISK_DOWNLOAD_CHUNKS", Int, "Number of concurrent ranged requests per download."},
+	{"BAZELISK_DOWNLOAD_LOCK_DIR", Path, "Directory with the lock files that deduplicate concurrent downloads."},
+	{"BAZELISK_DOWNLOAD_LOCK_TIMEOUT", Duration, "Maximum time to wait for another process that downloads the same binary."},
+	{"BAZELISK_FORMAT_URL", FormatURL, "URL template from which Bazel binaries are downloaded instead of GitHub."},
+	{"BAZELISK_GITHUB_TOKEN", Secret, "Token for requests to the GitHub API."},
+	{"BAZELISK_HEADER_TIMEOUT", Duration, "Maximum time to wait for response headers."},
+	{"BAZELISK_HOME", Path, "Directory in which Bazelisk stores downloaded binaries and cached listings."},
+	{"BAZELISK_HOME_DARWIN", Path, "BAZELISK_HOME on macOS."},
+	{"BAZELISK_HOME_LINUX", Path, "BAZELISK_HOME on Linux."},
+	{"BAZELISK_HOME_WINDOWS", Path, "BAZELISK_HOME on Windows."},
+	{"BAZELISK_HTTP_HEADERS", Secret, "Additional headers for download requests."},
+	{"BAZELISK_IDLE_TIMEOUT", Duration, "Maximum time that reading a response body may stall."},
+	{"BAZELISK_INCOMPATIBLE_FLAGS", String, "Comma-separated incompatible flags for --migrate."},
+	{"BAZELISK_LISTING_TTL", Duration, "How long cached lists of available versions are used without revalidation."},
+	{"BAZELISK_MAX_BANDWIDTH", String, "Maximum download speed in bytes per second, optionally with a K, M or G suffix."},
+	{"BAZELISK_NETRC", Path, "Netrc file with credentials for download requests."},
+	{"BAZELISK_NOJDK", Bool, "Download Bazel binaries without a bundled JDK."},
+	{"BAZELISK_NO_PROXY", String, "Comma-separated hosts or domains that bypass BAZELISK_PROXY."},
+	{"BAZELISK_PROXY", String, "Proxy URL for all requests, or \"direct\" to disable proxies."},
+	{"BAZELISK_RATE_LIMIT_WAIT", Duration, "Maximum time to wait for an exhausted GitHub rate limit to reset."},
+	{"BAZELISK_SHOW_PROGRESS", String, "How progress is displayed: auto, yes, no or plain."},
+	{"BAZELISK_SHUTDOWN", Bool, "Run `shutdown` between builds when migrating or bisecting."},
+	{"BAZELISK_SKIP_WRAPPER", String, "Don't run tools/bazel wrappers if set to any value."},
+	{"BAZELISK_USER_AGENT", String, "User agent for all requests."},
+	{"BAZELISK_VERBOSITY", Int, "Amount of logging; higher values log more."},
+	{"BAZELISK_VERIFY_SHA256", SHA256, "Expected SHA-256 digest of the Bazel binary."},
+	{"BAZELISK_WRAPPER_DIRECTORY", Path, "Directory of the wrapper script relative to the workspace root, instead of tools."},
+	{"USE_BAZEL_FALLBACK_VERSION", String, "Version to use without .bazelversion, optionally prefixed with error:, warn: or silent:."},
+	{"USE_BAZEL_VERSION", VersionLabel, "Bazel version to use, which takes precedence over .bazelversion."},
+}
+
+// LookupKey returns the schema entry of the key with the given name.
+func LookupKey(name string) (Key, bool) {
+	i := sort.Search(len(Schema), func(i int) bool { return Schema[i].Name >= name })
+	if i < len(Schema) && Schema[i].Name == name {
+		return Schema[i], true
+	}
+	return Key{}, false
+}
+
+// Check validates the config and returns a warning for every malformed value of a known key, and for every unknown
+// key in a config file. Values in config files are validated even if they aren't effective, e.g. because they are
+// meant for another platform. Unknown environment variables are ignored, since the environment contains much more
+// than Bazelisk's settings.
+func Check(c Config) []string {
+	layers := []Config{c}
+	if l, ok := c.(*layered); ok {
+		layers = l.configs
+	}
+
+	var warnings []string
+	// reported contains the locations of the invalid values that have already been reported.
+	reported := make(map[string]bool)
+	for _, key := range Schema {
+		value := c.Get(key.Name)
+		if value == "" {
+			continue
+		}
+		if err := key.Type.Validate(value); err != nil {
+			prefix := ""
+			if sources := Sources(c, key.Name); len(sources) > 0 && sources[0].Location != "" {
+				prefix = sources[0].Location + ": "
+				reported[sources[0].Location] = true
+			}
+			warnings = append(warnings, fmt.Sprintf("%sinvalid value %q for %s: %v", prefix, value, key.Name, err))
+		}
+	}
+
+	for _, layer := range layers {
+		f, ok := fileConfig(layer)
+		if !ok {
+			continue
+		}
+		warnings = append(warnings, f.warnings...)
+		origins := f.origins
+		names := make([]string, 0, len(origins))
+		for name := range origins {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if key, ok := LookupKey(trimPlatformSuffix(name)); ok {
+				// Values that aren't effective, e.g. because they are for another platform, should be valid nevertheless.
+				value := f.values[name]
+				if value != "" && !reported[origins[name]] {
+					if err := key.Type.Validate(value); err != nil {
+						warnings = append(warnings, fmt.Sprintf("%s: invalid value %q for %s: %v", origins[name], value, name, err))
+					}
+				}
+				continue
+			}
+			warning := fmt.Sprintf("%s: unknown key %s", origins[name], name)
+			if suggestion := closestKey(name); suggestion != "" {
+				warning += fmt.Sprintf(" (did you mean %s?)", suggestion)
+			}
+			warnings = append(warnings, warning)
+		}
+	}
+	return warnings
+}
+
+// fileConfig returns the static config that a layer is based on, if any.
+func fileConfig(c Config) (*static, bool) {
+	switch c := c.(type) {
+	case *static:
+		return c, true
+	case *platformSpecific:
+		return fileConfig(c.config)
+	}
+	return nil, false
+}
+
+// closestKey returns the known key that is most similar to the given name, if it's likely to be a typo.
+func closestKey(name string) string {
+	best, bestDistance := "", 3
+	for _, key := range Schema {
+		if d := editDistance(name, key.Name); d < bestDistance {
+			best, bestDistance = key.Name, d
+		}
+	}
+	return best
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
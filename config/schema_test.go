@@ -0,0 +1,111 @@
+package config
+
+import (
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestSchemaIsSorted(t *testing.T) {
+	if !sort.SliceIsSorted(Schema, func(i, j int) bool { return Schema[i].Name < Schema[j].Name }) {
+		t.Errorf("Expected Schema to be sorted by name, since LookupKey relies on it")
+	}
+	for _, key := range Schema {
+		if got, ok := LookupKey(key.Name); !ok || got != key {
+			t.Errorf("Expected to look up %s, but got %v", key.Name, got)
+		}
+	}
+	if _, ok := LookupKey("BAZELISK_UNKNOWN"); ok {
+		t.Errorf("Expected BAZELISK_UNKNOWN not to be found")
+	}
+}
+
+func TestTypeValidate(t *testing.T) {
+	tests := []struct {
+		typ     Type
+		value   string
+		wantErr bool
+	}{
+		{typ: Bool, value: "TRUE"},
+		{typ: Bool, value: "0"},
+		{typ: Bool, value: "on", wantErr: true},
+		{typ: Int, value: "4"},
+		{typ: Int, value: "four", wantErr: true},
+		{typ: Duration, value: "1m30s"},
+		{typ: Duration, value: "90", wantErr: true},
+		{typ: URL, value: "https://mirror.example.com/bazel"},
+		{typ: URL, value: "mirror.example.com", wantErr: true},
+		{typ: FormatURL, value: "https://mirror.example.com/%v/bazel-%v-%o-%m%e"},
+		{typ: FormatURL, value: "https://mirror.example.com/bazel-%v?sha256=%h&literal=100%%"},
+		{typ: FormatURL, value: "https://mirror.example.com/bazel-%x", wantErr: true},
+		{typ: FormatURL, value: "https://mirror.example.com/bazel-%", wantErr: true},
+		{typ: FormatURL, value: "mirror.example.com/%v", wantErr: true},
+		{typ: SHA256, value: "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"},
+		{typ: SHA256, value: "e3b0c442", wantErr: true},
+		{typ: VersionLabel, value: "7.1.0"},
+		{typ: VersionLabel, value: "fork/latest-1"},
+		{typ: VersionLabel, value: "~/bin/bazel"},
+		{typ: VersionLabel, value: "a/b/c", wantErr: true},
+		{typ: VersionLabel, value: "7.1.0 ", wantErr: true},
+		{typ: VersionLabel, value: ">=7.1.0 <8"},
+		{typ: VersionLabel, value: "fork/>= 6.4, < 7"},
+		{typ: VersionLabel, value: "~7.2"},
+		{typ: VersionLabel, value: "~>4.1.0"},
+		{typ: VersionLabel, value: ">=", wantErr: true},
+		{typ: VersionLabel, value: "^7.x", wantErr: true},
+		{typ: VersionLabel, value: "seven", wantErr: true},
+		{typ: String, value: "anything goes"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.typ.String()+"/"+tc.value, func(t *testing.T) {
+			err := tc.typ.Validate(tc.value)
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Errorf("Expected error: %v, but got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	path := writeRcFile(t, t.TempDir(), ".bazeliskrc", "USE_BAZEL_VERISON=7.0.0\nBAZELISK_DOWNLOAD_CHUNKS=many\nMY_OWN_VARIABLE=1\n")
+	file, err := FromFile(path)
+	if err != nil {
+		t.Fatalf("Could not parse %s: %v", path, err)
+	}
+	c := Layered(Static(map[string]string{"BAZELISK_CONNECT_TIMEOUT": "10", "SOME_ENV_VAR": "x"}), file)
+
+	want := []string{
+		`invalid value "10" for BAZELISK_CONNECT_TIMEOUT: must be a duration such as 30s or 1h`,
+		filepath.Clean(path) + `:2: invalid value "many" for BAZELISK_DOWNLOAD_CHUNKS: must be an integer`,
+		filepath.Clean(path) + ":3: unknown key MY_OWN_VARIABLE",
+		filepath.Clean(path) + ":1: unknown key USE_BAZEL_VERISON (did you mean USE_BAZEL_VERSION?)",
+	}
+	if got := Check(c); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected warnings %q, but got %q", want, got)
+	}
+}
+
+func TestCheckAcceptsFormatURL(t *testing.T) {
+	c := Static(map[string]string{"BAZELISK_FORMAT_URL": "https://mirror.example.com/%v/bazel-%v-%o-%m%e"})
+	if got := Check(c); len(got) > 0 {
+		t.Errorf("Expected no warnings, but got %q", got)
+	}
+}
+
+func TestCheckPlatformSpecificKeys(t *testing.T) {
+	path := writeRcFile(t, t.TempDir(), ".bazeliskrc", "BAZELISK_NOJDK_WINDOWS=maybe\nBAZELISK_NOJDK_LINUX=perhaps\n")
+	file, err := FromFile(path)
+	if err != nil {
+		t.Fatalf("Could not parse %s: %v", path, err)
+	}
+	c := Layered(platformSpecificFor(file, "linux", "amd64"))
+
+	want := []string{
+		filepath.Clean(path) + `:2: invalid value "perhaps" for BAZELISK_NOJDK: must be one of 1, true, yes, 0, false or no`,
+		filepath.Clean(path) + `:1: invalid value "maybe" for BAZELISK_NOJDK_WINDOWS: must be one of 1, true, yes, 0, false or no`,
+	}
+	if got := Check(c); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected warnings %q, but got %q", want, got)
+	}
+}
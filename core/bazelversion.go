@@ -0,0 +1,113 @@
+package core
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/bazelbuild/bazelisk/config"
+	"github.com/bazelbuild/bazelisk/versions"
+)
+
+// hintPattern matches the hints that can follow a version in a .bazelversion file.
+var hintPattern = regexp.MustCompile(`^[a-z_]+=`)
+
+// versionHints maps the names of the URL hints in a .bazelversion file to the config keys that they set.
+var versionHints = map[string]string{
+	"base_url":   BaseURLEnv,
+	"format_url": FormatURLEnv,
+}
+
+// versionCandidate is a Bazel version that is acceptable for a workspace.
+type versionCandidate struct {
+	// version is a version label, optionally prefixed with a fork, or the path of a Bazel binary.
+	version string
+	// urls contains the config values set by the URL hints of the version, if any.
+	urls map[string]string
+	// location is "path:line" if the version comes from a .bazelversion file.
+	location string
+}
+
+// configFor returns the config for downloading the candidate. URL hints only apply if neither BAZELISK_BASE_URL nor
+// BAZELISK_FORMAT_URL is configured, so that a mirror configured by the user always takes precedence.
+func (vc versionCandidate) configFor(c config.Config) config.Config {
+	if len(vc.urls) == 0 || c.Get(BaseURLEnv) != "" || c.Get(FormatURLEnv) != "" {
+		return c
+	}
+	return config.Layered(config.Static(vc.urls), c)
+}
+
+// parseBazelVersionFile returns the versions in a .bazelversion file in order of preference.
+//
+// Every line contains one version or version constraint, optionally followed by hints of the form key=value:
+//   - fork=NAME downloads the version from the given fork, like the NAME/VERSION syntax.
+//   - base_url=URL and format_url=URL download the version like BAZELISK_BASE_URL and BAZELISK_FORMAT_URL.
+//
+// Empty lines and everything from a # at the start of a line or after whitespace are ignored.
+// Bazel and other tools only read the first line, which should therefore contain just a version.
+func parseBazelVersionFile(path string) ([]versionCandidate, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read %s: %v", path, err)
+	}
+	defer f.Close()
+
+	var candidates []versionCandidate
+	scanner := bufio.NewScanner(f)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		location := fmt.Sprintf("%s:%d", path, lineNumber)
+		fields := strings.Fields(stripVersionComment(scanner.Text()))
+		if len(fields) == 0 {
+			continue
+		}
+		// Constraints such as ">=7.1.0 <8" contain whitespace, so all of their fields that aren't hints belong to them.
+		versionFields := 1
+		if versions.IsConstraint(fields[0]) {
+			for versionFields < len(fields) && !hintPattern.MatchString(fields[versionFields]) {
+				versionFields++
+			}
+		}
+		candidate := versionCandidate{version: strings.Join(fields[:versionFields], " "), location: location}
+		for _, hint := range fields[versionFields:] {
+			key, value, _ := strings.Cut(hint, "=")
+			if !hintPattern.MatchString(hint) || value == "" {
+				return nil, fmt.Errorf("%s: invalid hint %q, expected key=value", location, hint)
+			}
+			if key == "fork" {
+				if strings.Contains(candidate.version, "/") {
+					return nil, fmt.Errorf("%s: version %q already specifies a fork", location, candidate.version)
+				}
+				candidate.version = value + "/" + candidate.version
+				continue
+			}
+			name, ok := versionHints[key]
+			if !ok {
+				return nil, fmt.Errorf("%s: unknown hint %q, expected fork, base_url or format_url", location, key)
+			}
+			if candidate.urls == nil {
+				candidate.urls = make(map[string]string)
+			}
+			candidate.urls[name] = value
+		}
+		if len(candidate.urls) > 1 {
+			return nil, fmt.Errorf("%s: cannot set base_url and format_url at once", location)
+		}
+		candidates = append(candidates, candidate)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read version from file %s: %v", path, err)
+	}
+	return candidates, nil
+}
+
+// stripVersionComment removes a comment that starts at the beginning of the line or after whitespace.
+func stripVersionComment(line string) string {
+	for i := 0; i < len(line); i++ {
+		if line[i] == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t') {
+			return line[:i]
+		}
+	}
+	return line
+}
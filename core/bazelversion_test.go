@@ -0,0 +1,264 @@
+package core
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/bazelbuild/bazelisk/config"
+	"github.com/bazelbuild/bazelisk/httputil"
+	"github.com/bazelbuild/bazelisk/platforms"
+)
+
+func TestParseBazelVersionFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+		want     []versionCandidate
+		wantErr  string
+	}{
+		{
+			name:     "single version",
+			contents: "7.1.0\n",
+			want:     []versionCandidate{{version: "7.1.0", location: ":1"}},
+		},
+		{
+			name:     "comments and empty lines",
+			contents: "# Pinned for CI.\n\n7.1.0 # latest tested\n  # 6.5.0\nfork/7.0.0#1\n",
+			want: []versionCandidate{
+				{version: "7.1.0", location: ":3"},
+				{version: "fork/7.0.0#1", location: ":5"},
+			},
+		},
+		{
+			name:     "hints",
+			contents: "7.1.0\n7.0.0 fork=mirror\n6.5.0 base_url=https://mirror.example.com/bazel\n",
+			want: []versionCandidate{
+				{version: "7.1.0", location: ":1"},
+				{version: "mirror/7.0.0", location: ":2"},
+				{version: "6.5.0", urls: map[string]string{BaseURLEnv: "https://mirror.example.com/bazel"}, location: ":3"},
+			},
+		},
+		{
+			name:     "constraints",
+			contents: ">=7.1.0 <8 base_url=https://mirror.example.com/bazel\n~6.5\n",
+			want: []versionCandidate{
+				{version: ">=7.1.0 <8", urls: map[string]string{BaseURLEnv: "https://mirror.example.com/bazel"}, location: ":1"},
+				{version: "~6.5", location: ":2"},
+			},
+		},
+		{
+			name:     "empty file",
+			contents: "# No version yet.\n",
+		},
+		{
+			name:     "unknown hint",
+			contents: "7.1.0 mirror=https://example.com\n",
+			wantErr:  `:1: unknown hint "mirror"`,
+		},
+		{
+			name:     "malformed hint",
+			contents: "7.1.0 base_url\n",
+			wantErr:  `:1: invalid hint "base_url"`,
+		},
+		{
+			name:     "two forks",
+			contents: "7.1.0\nfork/7.0.0 fork=other\n",
+			wantErr:  `:2: version "fork/7.0.0" already specifies a fork`,
+		},
+		{
+			name:     "two URLs",
+			contents: "7.1.0 base_url=https://example.com format_url=https://example.com/%v\n",
+			wantErr:  ":1: cannot set base_url and format_url at once",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), ".bazelversion")
+			writeWorkspaceFile(t, path, tc.contents)
+			for i := range tc.want {
+				tc.want[i].location = path + tc.want[i].location
+			}
+
+			got, err := parseBazelVersionFile(path)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("Expected error containing %q, but got %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Expected %+v, but got %+v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestVersionCandidateURLHints(t *testing.T) {
+	candidate := versionCandidate{version: "7.1.0", urls: map[string]string{BaseURLEnv: "https://hint.example.com"}}
+
+	if got := candidate.configFor(config.Null()).Get(BaseURLEnv); got != "https://hint.example.com" {
+		t.Errorf("Expected the hint to set %s, but got %q", BaseURLEnv, got)
+	}
+	for _, name := range []string{BaseURLEnv, FormatURLEnv} {
+		c := config.Static(map[string]string{name: "https://user.example.com"})
+		if got := candidate.configFor(c); got != c {
+			t.Errorf("Expected %s to take precedence over the hint", name)
+		}
+	}
+}
+
+func TestInstallationPrefersInstalledVersion(t *testing.T) {
+	if _, ok := os.LookupEnv("USE_BAZEL_VERSION"); ok {
+		t.Skip("USE_BAZEL_VERSION is set in the environment")
+	}
+
+	workspace := t.TempDir()
+	writeWorkspaceFile(t, filepath.Join(workspace, "MODULE.bazel"), "")
+	writeWorkspaceFile(t, filepath.Join(workspace, ".bazelversion"), "7.1.0\nlatest\n6.5.0\n")
+
+	bazeliskHome := t.TempDir()
+	cfg := config.Static(map[string]string{"BAZELISK_HOME": bazeliskHome})
+	pathSegment, err := platforms.DetermineBazelFilename("6.5.0", false, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := strings.Repeat("a", 64)
+	writeWorkspaceFile(t, filepath.Join(bazeliskHome, "downloads", "metadata", "bazelbuild", pathSegment), digest)
+	installed := filepath.Join(bazeliskHome, "downloads", "sha256", digest, "bin", "bazel"+platforms.DetermineExecutableFilenameSuffix())
+	writeWorkspaceFile(t, installed, "")
+
+	// The repositories fail every request, so only the installed version can be used.
+	repos := CreateRepositories(nil, nil, nil, nil, false)
+	installation, err := GetBazelInstallationForWorkspace(context.Background(), repos, cfg, workspace)
+	if err != nil {
+		t.Fatalf("Could not get installation: %v", err)
+	}
+	if installation.Version != "6.5.0" || installation.Path != installed {
+		t.Errorf("Expected Bazel 6.5.0 at %s, but got %s at %s", installed, installation.Version, installation.Path)
+	}
+}
+
+func TestInstallationFallsBackToNextVersion(t *testing.T) {
+	if _, ok := os.LookupEnv("USE_BAZEL_VERSION"); ok {
+		t.Skip("USE_BAZEL_VERSION is set in the environment")
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/7.0.0/") {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("#!/bin/sh\necho bazel\n"))
+	}))
+	t.Cleanup(server.Close)
+
+	workspace := t.TempDir()
+	writeWorkspaceFile(t, filepath.Join(workspace, "MODULE.bazel"), "")
+	writeWorkspaceFile(t, filepath.Join(workspace, ".bazelversion"), "7.1.0 base_url="+server.URL+"\n7.0.0 base_url="+server.URL+"\n")
+
+	cfg := config.Static(map[string]string{"BAZELISK_HOME": t.TempDir()})
+	repos := CreateRepositories(nil, nil, nil, nil, true)
+	installation, err := GetBazelInstallationForWorkspace(context.Background(), repos, cfg, workspace)
+	if err != nil {
+		t.Fatalf("Could not get installation: %v", err)
+	}
+	if installation.Version != "7.0.0" {
+		t.Errorf("Expected Bazel 7.0.0, but got %s", installation.Version)
+	}
+}
+
+func TestInstallationDoesNotFallBackOnTransientErrors(t *testing.T) {
+	if _, ok := os.LookupEnv("USE_BAZEL_VERSION"); ok {
+		t.Skip("USE_BAZEL_VERSION is set in the environment")
+	}
+	oldRetries := httputil.MaxRetries
+	httputil.MaxRetries = 0
+	t.Cleanup(func() { httputil.MaxRetries = oldRetries })
+
+	var fallbackRequested atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/7.0.0/") {
+			fallbackRequested.Store(true)
+			w.Write([]byte("#!/bin/sh\necho bazel\n"))
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(server.Close)
+
+	workspace := t.TempDir()
+	writeWorkspaceFile(t, filepath.Join(workspace, "MODULE.bazel"), "")
+	writeWorkspaceFile(t, filepath.Join(workspace, ".bazelversion"), "7.1.0 base_url="+server.URL+"\n7.0.0 base_url="+server.URL+"\n")
+
+	cfg := config.Static(map[string]string{"BAZELISK_HOME": t.TempDir()})
+	repos := CreateRepositories(nil, nil, nil, nil, true)
+	if _, err := GetBazelInstallationForWorkspace(context.Background(), repos, cfg, workspace); err == nil || !strings.Contains(err.Error(), "HTTP 503") {
+		t.Fatalf("Expected the failure of Bazel 7.1.0 to be reported, but got %v", err)
+	}
+	if fallbackRequested.Load() {
+		t.Error("Expected no fallback to Bazel 7.0.0 after a transient error")
+	}
+}
+
+// fakeLTSRepo serves fake binaries for the given versions.
+type fakeLTSRepo struct {
+	versions []string
+}
+
+func (r *fakeLTSRepo) GetLTSVersions(ctx context.Context, bazeliskHome string, opts *FilterOpts) ([]string, error) {
+	return r.versions, nil
+}
+
+func (r *fakeLTSRepo) DownloadLTS(ctx context.Context, version, destDir, destFile string, config config.Config) (string, error) {
+	path := filepath.Join(destDir, destFile)
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		return "", err
+	}
+	return path, os.WriteFile(path, []byte("#!/bin/sh\necho bazel "+version+"\n"), 0755)
+}
+
+func TestInstallationResolvesTildeConstraints(t *testing.T) {
+	if _, ok := os.LookupEnv("USE_BAZEL_VERSION"); ok {
+		t.Skip("USE_BAZEL_VERSION is set in the environment")
+	}
+
+	tests := []struct {
+		constraint  string
+		wantVersion string
+	}{
+		{constraint: "~7.2", wantVersion: "7.2.1"},
+		{constraint: "~>7.1.0", wantVersion: "7.1.2"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.constraint, func(t *testing.T) {
+			workspace := t.TempDir()
+			writeWorkspaceFile(t, filepath.Join(workspace, "MODULE.bazel"), "")
+			writeWorkspaceFile(t, filepath.Join(workspace, ".bazelversion"), test.constraint+"\n")
+
+			cfg := config.Static(map[string]string{"BAZELISK_HOME": t.TempDir()})
+			repos := CreateRepositories(&fakeLTSRepo{versions: []string{"7.1.2", "7.2.0", "7.2.1", "7.3.0"}}, nil, nil, nil, false)
+			installation, err := GetBazelInstallationForWorkspace(context.Background(), repos, cfg, workspace)
+			if err != nil {
+				t.Fatalf("Could not get installation: %v", err)
+			}
+			content, err := os.ReadFile(installation.Path)
+			if err != nil {
+				t.Fatalf("Could not read installed binary: %v", err)
+			}
+			if !strings.Contains(string(content), "bazel "+test.wantVersion+"\n") {
+				t.Errorf("Expected Bazel %s, but got binary %q", test.wantVersion, content)
+			}
+		})
+	}
+}
@@ -4,13 +4,14 @@ package core
 // TODO: split this file into multiple smaller ones in dedicated packages (e.g. execution, incompatible, ...).
 
 import (
-	"bufio"
 	"context"
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"log"
 	"net/http"
 	"os"
@@ -26,6 +27,7 @@ import (
 
 	"github.com/bazelbuild/bazelisk/config"
 	"github.com/bazelbuild/bazelisk/httputil"
+	"github.com/bazelbuild/bazelisk/httputil/progress"
 	"github.com/bazelbuild/bazelisk/platforms"
 	"github.com/bazelbuild/bazelisk/versions"
 	"github.com/bazelbuild/bazelisk/ws"
@@ -51,33 +53,60 @@ var (
 // Bazel with.
 type ArgsFunc func(resolvedBazelVersion string) []string
 
-// MakeDefaultConfig returns a config based on env and .bazeliskrc files.
+// MakeDefaultConfig returns a config based on env and .bazeliskrc files, and logs a warning for every unknown key
+// and malformed value. See config.LocateConfigFiles for the order in which the files take precedence.
+// Within each of them, keys can be overridden for the current platform (see config.PlatformSpecific).
 func MakeDefaultConfig() config.Config {
-	configs := []config.Config{config.FromEnv()}
+	c, err := MakeConfigForWorkspace("")
+	if err != nil {
+		log.Fatal(err)
+	}
+	return c
+}
 
-	workspaceConfigPath, err := config.LocateWorkspaceConfigFile()
-	if err == nil {
-		c, err := config.FromFile(workspaceConfigPath)
+// MakeConfigForWorkspace behaves like MakeDefaultConfig, but reads the workspace and per-directory .bazeliskrc files
+// relative to the given directory instead of the current working directory. This allows tools to handle
+// multiple workspaces in a single process. An empty directory stands for the current working directory.
+func MakeConfigForWorkspace(workingDirectory string) (config.Config, error) {
+	systemConfigFile, _ := config.LocateSystemConfigFile()
+	configs := []config.Config{config.PlatformSpecific(config.FromEnv())}
+	for _, path := range config.LocateConfigFilesIn(workingDirectory) {
+		c, err := readConfigFile(path, path == systemConfigFile)
 		if err != nil {
-			log.Fatal(err)
+			return nil, err
+		}
+		if c != nil {
+			configs = append(configs, config.PlatformSpecific(c))
 		}
-		configs = append(configs, c)
 	}
+	c := config.Layered(configs...)
+	for _, warning := range config.Check(c) {
+		log.Printf("Warning: %s", warning)
+	}
+	return c, nil
+}
 
-	userConfigPath, err := config.LocateUserConfigFile()
-	if err == nil {
-		c, err := config.FromFile(userConfigPath)
-		if err != nil {
-			log.Fatal(err)
-		}
-		configs = append(configs, c)
+// readConfigFile reads the config file at the given path. The system-wide file is managed by administrators, who
+// may restrict its permissions, so if it is unreadable, readConfigFile only logs a warning and returns a nil config.
+func readConfigFile(path string, system bool) (config.Config, error) {
+	c, err := config.FromFile(path)
+	if system && errors.Is(err, fs.ErrPermission) {
+		log.Printf("Warning: ignoring %s: %v", path, err)
+		return nil, nil
 	}
-	return config.Layered(configs...)
+	return c, err
 }
 
 // RunBazelisk runs the main Bazelisk logic for the given arguments and Bazel repositories.
 func RunBazelisk(args []string, repos *Repositories) (int, error) {
-	return RunBazeliskWithArgsFunc(func(_ string) []string { return args }, repos)
+	config := MakeDefaultConfig()
+	if ok, err := PrintConfigIfRequested(args, config, os.Stdout); ok {
+		if err != nil {
+			return -1, err
+		}
+		return 0, nil
+	}
+	return RunBazeliskWithArgsFuncAndConfig(func(_ string) []string { return args }, repos, config)
 }
 
 // RunBazeliskWithArgsFunc runs the main Bazelisk logic for the given ArgsFunc and Bazel
@@ -96,8 +125,6 @@ func RunBazeliskWithArgsFuncAndConfig(argsFunc ArgsFunc, repos *Repositories, co
 // RunBazeliskWithArgsFuncAndConfigAndOut runs the main Bazelisk logic for the given ArgsFunc and Bazel
 // repositories and config, writing its stdout to the passed writer.
 func RunBazeliskWithArgsFuncAndConfigAndOut(argsFunc ArgsFunc, repos *Repositories, config config.Config, out io.Writer) (int, error) {
-	httputil.UserAgent = getUserAgent(config)
-
 	bazelInstallation, err := GetBazelInstallation(repos, config)
 	if err != nil {
 		return -1, err
@@ -192,8 +219,26 @@ type BazelInstallation struct {
 	Path    string
 }
 
-// GetBazelInstallation provides a mechanism to find the `bazel` binary to execute, as well as its version
+// GetBazelInstallation provides a mechanism to find the `bazel` binary to execute, as well as its version.
+// It applies the HTTP settings from the config, such as the CA bundle, proxy and timeouts, to all requests.
 func GetBazelInstallation(repos *Repositories, config config.Config) (*BazelInstallation, error) {
+	return GetBazelInstallationWithContext(context.Background(), repos, config)
+}
+
+// GetBazelInstallationWithContext behaves like GetBazelInstallation, but aborts version resolution and downloads once the given context is cancelled.
+func GetBazelInstallationWithContext(ctx context.Context, repos *Repositories, config config.Config) (*BazelInstallation, error) {
+	return GetBazelInstallationForWorkspace(ctx, repos, config, "")
+}
+
+// GetBazelInstallationForWorkspace behaves like GetBazelInstallationWithContext, but determines the Bazel version
+// for the workspace that contains the given directory instead of the current working directory.
+// The config should come from MakeConfigForWorkspace for the same directory.
+// An empty directory stands for the current working directory.
+func GetBazelInstallationForWorkspace(ctx context.Context, repos *Repositories, config config.Config, workingDirectory string) (*BazelInstallation, error) {
+	if err := configureDownloads(config); err != nil {
+		return nil, err
+	}
+
 	bazeliskHome, err := getBazeliskHome(config)
 	if err != nil {
 		return nil, fmt.Errorf("could not determine Bazelisk home directory: %v", err)
@@ -204,12 +249,60 @@ func GetBazelInstallation(repos *Repositories, config config.Config) (*BazelInst
 		return nil, fmt.Errorf("could not create directory %s: %v", bazeliskHome, err)
 	}
 
-	bazelVersionString, err := GetBazelVersion(config)
+	candidates, err := getBazelVersionCandidates(config, workingDirectory)
 	if err != nil {
 		return nil, fmt.Errorf("could not get Bazel version: %v", err)
 	}
+	if len(candidates) == 1 {
+		return installBazel(ctx, candidates[0].version, bazeliskHome, repos, candidates[0].configFor(config))
+	}
+
+	// Prefer a version that is already installed, so that we don't have to go online.
+	for _, candidate := range candidates {
+		if isInstalled(candidate, bazeliskHome, config) {
+			return installBazel(ctx, candidate.version, bazeliskHome, repos, candidate.configFor(config))
+		}
+	}
 
-	bazelPath, err := homedir.Expand(bazelVersionString)
+	var errs []string
+	for _, candidate := range candidates {
+		installation, err := installBazel(ctx, candidate.version, bazeliskHome, repos, candidate.configFor(config))
+		if err == nil {
+			return installation, nil
+		}
+		// Only fall back if the version doesn't exist, since other errors such as network failures would most likely
+		// affect the next version as well, and falling back would hide them.
+		if !isUnavailable(err) {
+			return nil, err
+		}
+		log.Printf("Could not use Bazel %s from %s, trying the next version: %v", candidate.version, candidate.location, err)
+		errs = append(errs, fmt.Sprintf("%s: %v", candidate.version, err))
+	}
+	return nil, fmt.Errorf("none of the Bazel versions in .bazelversion is available:\n%s", strings.Join(errs, "\n"))
+}
+
+// isUnavailable returns whether the error indicates that a Bazel version doesn't exist.
+func isUnavailable(err error) bool {
+	var notFound *VersionNotFoundError
+	return errors.As(err, &notFound) || errors.Is(err, httputil.ErrNotFound)
+}
+
+// configureDownloads applies the HTTP and progress settings from the config to all subsequent requests.
+func configureDownloads(config config.Config) error {
+	httputil.UserAgent = getUserAgent(config)
+	if err := httputil.ConfigureTransport(config); err != nil {
+		return fmt.Errorf("could not configure HTTP client: %v", err)
+	}
+	if err := progress.Configure(config); err != nil {
+		return fmt.Errorf("could not configure progress output: %v", err)
+	}
+	return nil
+}
+
+// installBazel returns the installation of the given Bazel version, which is downloaded if necessary,
+// or of the Bazel binary at the given path.
+func installBazel(ctx context.Context, bazelVersionString, bazeliskHome string, repos *Repositories, config config.Config) (*BazelInstallation, error) {
+	bazelPath, err := expandBazelPath(bazelVersionString)
 	if err != nil {
 		return nil, fmt.Errorf("could not expand home directory in path: %v", err)
 	}
@@ -220,9 +313,9 @@ func GetBazelInstallation(repos *Repositories, config config.Config) (*BazelInst
 	// download the version that the user wants.
 	if !filepath.IsAbs(bazelPath) {
 		resolvedVersion = bazelVersionString
-		bazelPath, err = downloadBazel(bazelVersionString, bazeliskHome, repos, config)
+		bazelPath, err = downloadBazel(ctx, bazelVersionString, bazeliskHome, repos, config)
 		if err != nil {
-			return nil, fmt.Errorf("could not download Bazel: %v", err)
+			return nil, fmt.Errorf("could not download Bazel: %w", err)
 		}
 	} else {
 		// If the Bazel version is an absolute path to a Bazel binary in the filesystem, we can
@@ -242,6 +335,45 @@ func GetBazelInstallation(repos *Repositories, config config.Config) (*BazelInst
 		nil
 }
 
+// expandBazelPath expands a leading "~" in the path of a local Bazel binary. Other labels are returned unchanged,
+// including version constraints such as "~7.2" or "~>4.1.0".
+func expandBazelPath(label string) (string, error) {
+	if label != "~" && !strings.HasPrefix(label, "~/") && !strings.HasPrefix(label, "~"+string(filepath.Separator)) {
+		return label, nil
+	}
+	return homedir.Expand(label)
+}
+
+// isInstalled returns whether the candidate can be used without downloading anything, i.e. whether it's the path of an
+// existing binary or an exact version that has already been downloaded. Relative versions such as "latest" would
+// require a listing of the available versions, so they never count as installed.
+func isInstalled(candidate versionCandidate, bazeliskHome string, config config.Config) bool {
+	path, err := expandBazelPath(candidate.version)
+	if err != nil {
+		return false
+	}
+	if filepath.IsAbs(path) {
+		_, err := os.Stat(path)
+		return err == nil
+	}
+
+	bazelFork, bazelVersion, err := parseBazelForkAndVersion(candidate.version)
+	if err != nil {
+		return false
+	}
+	vi, err := versions.Parse(bazelFork, bazelVersion)
+	if err != nil || vi.IsRelative {
+		return false
+	}
+	config = candidate.configFor(config)
+	mappingPath, err := mappingFilePath(bazelVersion, bazeliskHome, bazelForkOrURLDirName(bazelFork, config), config)
+	if err != nil {
+		return false
+	}
+	_, ok := lookUpInCAS(bazeliskHome, mappingPath)
+	return ok
+}
+
 func getBazelCommand(args []string) (string, error) {
 	for _, a := range args {
 		if !strings.HasPrefix(a, "-") {
@@ -289,8 +421,27 @@ func getUserAgent(config config.Config) string {
 	return fmt.Sprintf("Bazelisk/%s", BazeliskVersion)
 }
 
-// GetBazelVersion returns the Bazel version that should be used.
+// GetBazelVersion returns the Bazel version that should be used. If .bazelversion lists several versions, it returns
+// the first one, even though GetBazelInstallation may install a different one, e.g. because it's already installed.
 func GetBazelVersion(config config.Config) (string, error) {
+	return GetBazelVersionForWorkspace(config, "")
+}
+
+// GetBazelVersionForWorkspace returns the Bazel version that should be used in the workspace that contains the given
+// directory. An empty directory stands for the current working directory. If .bazelversion lists several versions,
+// it returns the first one, even though GetBazelInstallationForWorkspace may install a different one, e.g. because it's
+// already installed or the first one doesn't exist.
+func GetBazelVersionForWorkspace(config config.Config, workingDirectory string) (string, error) {
+	candidates, err := getBazelVersionCandidates(config, workingDirectory)
+	if err != nil {
+		return "", err
+	}
+	return candidates[0].version, nil
+}
+
+// getBazelVersionCandidates returns the acceptable Bazel versions in order of preference.
+// Only a .bazelversion file can list more than one.
+func getBazelVersionCandidates(config config.Config, workingDirectory string) ([]versionCandidate, error) {
 	// Check in this order:
 	// - env var "USE_BAZEL_VERSION" is set to a specific version.
 	// - workspace_root/.bazeliskrc exists -> read contents, in contents:
@@ -300,7 +451,7 @@ func GetBazelVersion(config config.Config) (string, error) {
 	// - env var "USE_CANARY_BAZEL" or "USE_BAZEL_CANARY" is set -> latest
 	//   rc. (TODO)
 	// - the file workspace_root/tools/bazel exists -> that version. (TODO)
-	// - workspace_root/.bazelversion exists -> read contents, that version.
+	// - workspace_root/.bazelversion exists -> read contents, those versions.
 	// - workspace_root/WORKSPACE contains a version -> that version. (TODO)
 	// - env var "USE_BAZEL_FALLBACK_VERSION" is set to a fallback version format.
 	// - workspace_root/.bazeliskrc exists -> read contents, in contents:
@@ -308,33 +459,26 @@ func GetBazelVersion(config config.Config) (string, error) {
 	// - fallback version format "silent:latest"
 	bazelVersion := config.Get("USE_BAZEL_VERSION")
 	if len(bazelVersion) != 0 {
-		return bazelVersion, nil
+		return []versionCandidate{{version: bazelVersion}}, nil
 	}
 
-	workingDirectory, err := os.Getwd()
+	// Like config.LocateConfigFilesIn, resolve relative directories against the current one.
+	// filepath.Abs("") returns the current directory.
+	workingDirectory, err := filepath.Abs(workingDirectory)
 	if err != nil {
-		return "", fmt.Errorf("could not get working directory: %v", err)
+		return nil, fmt.Errorf("could not get working directory: %v", err)
 	}
 
 	workspaceRoot := ws.FindWorkspaceRoot(workingDirectory)
 	if len(workspaceRoot) != 0 {
 		bazelVersionPath := filepath.Join(workspaceRoot, ".bazelversion")
 		if _, err := os.Stat(bazelVersionPath); err == nil {
-			f, err := os.Open(bazelVersionPath)
+			candidates, err := parseBazelVersionFile(bazelVersionPath)
 			if err != nil {
-				return "", fmt.Errorf("could not read %s: %v", bazelVersionPath, err)
+				return nil, err
 			}
-			defer f.Close()
-
-			scanner := bufio.NewScanner(f)
-			scanner.Scan()
-			bazelVersion := scanner.Text()
-			if err := scanner.Err(); err != nil {
-				return "", fmt.Errorf("could not read version from file %s: %v", bazelVersion, err)
-			}
-
-			if len(bazelVersion) != 0 {
-				return bazelVersion, nil
+			if len(candidates) != 0 {
+				return candidates, nil
 			}
 		}
 	}
@@ -348,16 +492,16 @@ func GetBazelVersion(config config.Config) (string, error) {
 		fallbackVersion = "latest"
 	}
 	if fallbackVersionMode == "error" {
-		return "", fmt.Errorf("not allowed to use fallback version %q", fallbackVersion)
+		return nil, fmt.Errorf("not allowed to use fallback version %q", fallbackVersion)
 	}
 	if fallbackVersionMode == "warn" {
 		log.Printf("Warning: used fallback version %q\n", fallbackVersion)
-		return fallbackVersion, nil
+		return []versionCandidate{{version: fallbackVersion}}, nil
 	}
 	if fallbackVersionMode == "silent" {
-		return fallbackVersion, nil
+		return []versionCandidate{{version: fallbackVersion}}, nil
 	}
-	return "", fmt.Errorf("invalid fallback version format %q (effectively %q)", fallbackVersionFormat, fmt.Sprintf("%s:%s", fallbackVersionMode, fallbackVersion))
+	return nil, fmt.Errorf("invalid fallback version format %q (effectively %q)", fallbackVersionFormat, fmt.Sprintf("%s:%s", fallbackVersionMode, fallbackVersion))
 }
 
 func parseBazelForkAndVersion(bazelForkAndVersion string) (string, string, error) {
@@ -376,26 +520,31 @@ func parseBazelForkAndVersion(bazelForkAndVersion string) (string, string, error
 	return bazelFork, bazelVersion, nil
 }
 
-func downloadBazel(bazelVersionString string, bazeliskHome string, repos *Repositories, config config.Config) (string, error) {
+func downloadBazel(ctx context.Context, bazelVersionString string, bazeliskHome string, repos *Repositories, config config.Config) (string, error) {
 	bazelFork, bazelVersion, err := parseBazelForkAndVersion(bazelVersionString)
 	if err != nil {
 		return "", fmt.Errorf("could not parse Bazel fork and version: %v", err)
 	}
 
-	resolvedBazelVersion, downloader, err := repos.ResolveVersion(bazeliskHome, bazelFork, bazelVersion, config)
+	resolvedBazelVersion, downloader, err := repos.ResolveVersion(ctx, bazeliskHome, bazelFork, bazelVersion, config)
 	if err != nil {
-		return "", fmt.Errorf("could not resolve the version '%s' to an actual version number: %v", bazelVersion, err)
+		return "", fmt.Errorf("could not resolve the version '%s' to an actual version number: %w", bazelVersion, err)
 	}
 
-	bazelForkOrURL := dirForURL(config.Get(BaseURLEnv))
-	if len(bazelForkOrURL) == 0 {
-		bazelForkOrURL = bazelFork
-	}
-
-	bazelPath, err := downloadBazelIfNecessary(resolvedBazelVersion, bazeliskHome, bazelForkOrURL, repos, config, downloader)
+	bazelForkOrURL := bazelForkOrURLDirName(bazelFork, config)
+	bazelPath, err := downloadBazelIfNecessary(ctx, resolvedBazelVersion, bazeliskHome, bazelForkOrURL, repos, config, downloader)
 	return bazelPath, err
 }
 
+// bazelForkOrURLDirName returns the name of the directory with the mapping files of binaries from the given fork,
+// which depends on BAZELISK_BASE_URL if it's set.
+func bazelForkOrURLDirName(bazelFork string, config config.Config) string {
+	if dir := dirForURL(config.Get(BaseURLEnv)); len(dir) != 0 {
+		return dir
+	}
+	return bazelFork
+}
+
 // downloadBazelIfNecessary returns a path to a bazel which can be run, which may have been cached.
 // The directory it returns may depend on version and bazeliskHome, but does not depend on bazelForkOrURLDirName.
 // This is important, as the directory may be added to $PATH, and varying the path for equivalent files may cause unnecessary repository rule cache invalidations.
@@ -405,24 +554,42 @@ func downloadBazel(bazelVersionString string, bazeliskHome string, repos *Reposi
 //
 //	downloads/metadata/[fork-or-url]/bazel-[version-os-etc] is a text file containing a hex sha256 of the contents of the downloaded bazel file.
 //	downloads/sha256/[sha256]/bin/bazel[extension] contains the bazel with a particular sha256.
-func downloadBazelIfNecessary(version string, bazeliskHome string, bazelForkOrURLDirName string, repos *Repositories, config config.Config, downloader DownloadFunc) (string, error) {
-	pathSegment, err := platforms.DetermineBazelFilename(version, false, config)
+func downloadBazelIfNecessary(ctx context.Context, version string, bazeliskHome string, bazelForkOrURLDirName string, repos *Repositories, config config.Config, downloader DownloadFunc) (string, error) {
+	mappingPath, err := mappingFilePath(version, bazeliskHome, bazelForkOrURLDirName, config)
 	if err != nil {
-		return "", fmt.Errorf("could not determine path segment to use for Bazel binary: %v", err)
+		return "", err
+	}
+	if pathToBazelInCAS, ok := lookUpInCAS(bazeliskHome, mappingPath); ok {
+		return pathToBazelInCAS, nil
 	}
 
-	destFile := "bazel" + platforms.DetermineExecutableFilenameSuffix()
-
-	mappingPath := filepath.Join(bazeliskHome, "downloads", "metadata", bazelForkOrURLDirName, pathSegment)
-	digestFromMappingFile, err := os.ReadFile(mappingPath)
-	if err == nil {
-		pathToBazelInCAS := filepath.Join(bazeliskHome, "downloads", "sha256", string(digestFromMappingFile), "bin", destFile)
-		if _, err := os.Stat(pathToBazelInCAS); err == nil {
+	// Make sure that concurrent Bazelisk processes don't download the same version from the same fork or URL in parallel.
+	// If the other process takes too long (e.g. because it hangs), we download the binary ourselves.
+	lockTimeout, err := httputil.GetDownloadLockTimeout(config)
+	if err != nil {
+		return "", err
+	}
+	lockCtx, cancel := context.WithTimeout(ctx, lockTimeout)
+	defer cancel()
+	unlock, err := httputil.LockDownload(lockCtx, bazeliskHome, mappingPath, config)
+	if err != nil {
+		if ctx.Err() != nil {
+			return "", fmt.Errorf("failed to download bazel: %w", ctx.Err())
+		}
+		if lockCtx.Err() != nil {
+			log.Printf("WARNING: Gave up waiting for another Bazelisk process to download Bazel %s after %v, downloading it now", version, lockTimeout)
+		} else {
+			log.Printf("WARNING: Unable to coordinate the download with other Bazelisk processes: %v", err)
+		}
+	} else {
+		defer unlock()
+		// Another process may have downloaded the binary while we were waiting for the lock.
+		if pathToBazelInCAS, ok := lookUpInCAS(bazeliskHome, mappingPath); ok {
 			return pathToBazelInCAS, nil
 		}
 	}
 
-	pathToBazelInCAS, downloadedDigest, err := downloadBazelToCAS(version, bazeliskHome, repos, config, downloader)
+	pathToBazelInCAS, downloadedDigest, err := downloadBazelToCAS(ctx, version, bazeliskHome, repos, config, downloader)
 	if err != nil {
 		return "", fmt.Errorf("failed to download bazel: %w", err)
 	}
@@ -441,6 +608,29 @@ func downloadBazelIfNecessary(version string, bazeliskHome string, bazelForkOrUR
 	return pathToBazelInCAS, nil
 }
 
+// mappingFilePath returns the path of the mapping file that contains the digest of the given version.
+func mappingFilePath(version, bazeliskHome, bazelForkOrURLDirName string, config config.Config) (string, error) {
+	pathSegment, err := platforms.DetermineBazelFilename(version, false, config)
+	if err != nil {
+		return "", fmt.Errorf("could not determine path segment to use for Bazel binary: %v", err)
+	}
+	return filepath.Join(bazeliskHome, "downloads", "metadata", bazelForkOrURLDirName, pathSegment), nil
+}
+
+// lookUpInCAS returns the path of the binary whose digest is stored in the mapping file, if it has been downloaded.
+func lookUpInCAS(bazeliskHome, mappingPath string) (string, bool) {
+	digestFromMappingFile, err := os.ReadFile(mappingPath)
+	if err != nil {
+		return "", false
+	}
+	destFile := "bazel" + platforms.DetermineExecutableFilenameSuffix()
+	pathToBazelInCAS := filepath.Join(bazeliskHome, "downloads", "sha256", string(digestFromMappingFile), "bin", destFile)
+	if _, err := os.Stat(pathToBazelInCAS); err != nil {
+		return "", false
+	}
+	return pathToBazelInCAS, true
+}
+
 func atomicWriteFile(path string, contents []byte, perm os.FileMode) error {
 	parent := filepath.Dir(path)
 	if err := os.MkdirAll(parent, 0755); err != nil {
@@ -490,7 +680,7 @@ func lockedRenameIfDstAbsent(src, dst string) error {
 	return os.Rename(src, dst)
 }
 
-func downloadBazelToCAS(version string, bazeliskHome string, repos *Repositories, config config.Config, downloader DownloadFunc) (string, string, error) {
+func downloadBazelToCAS(ctx context.Context, version string, bazeliskHome string, repos *Repositories, config config.Config, downloader DownloadFunc) (string, string, error) {
 	downloadsDir := filepath.Join(bazeliskHome, "downloads")
 	temporaryDownloadDir := filepath.Join(downloadsDir, "_tmp")
 	casDir := filepath.Join(bazeliskHome, "downloads", "sha256")
@@ -508,11 +698,11 @@ func downloadBazelToCAS(version string, bazeliskHome string, repos *Repositories
 	if baseURL != "" && formatURL != "" {
 		return "", "", fmt.Errorf("cannot set %s and %s at once", BaseURLEnv, FormatURLEnv)
 	} else if formatURL != "" {
-		tmpDestPath, err = repos.DownloadFromFormatURL(config, formatURL, version, temporaryDownloadDir, tmpDestFile)
+		tmpDestPath, err = repos.DownloadFromFormatURL(ctx, config, formatURL, version, temporaryDownloadDir, tmpDestFile)
 	} else if baseURL != "" {
-		tmpDestPath, err = repos.DownloadFromBaseURL(baseURL, version, temporaryDownloadDir, tmpDestFile, config)
+		tmpDestPath, err = repos.DownloadFromBaseURL(ctx, baseURL, version, temporaryDownloadDir, tmpDestFile, config)
 	} else {
-		tmpDestPath, err = downloader(temporaryDownloadDir, tmpDestFile)
+		tmpDestPath, err = downloader(ctx, temporaryDownloadDir, tmpDestFile)
 	}
 	if err != nil {
 		return "", "", fmt.Errorf("failed to download bazel: %w", err)
@@ -522,9 +712,16 @@ func downloadBazelToCAS(version string, bazeliskHome string, repos *Repositories
 	if err != nil {
 		return "", "", fmt.Errorf("failed to open downloaded bazel to digest it: %w", err)
 	}
+	var size int64
+	if fi, err := f.Stat(); err == nil {
+		size = fi.Size()
+	}
 
 	h := sha256.New()
-	if _, err := io.Copy(h, f); err != nil {
+	progress.Default.Start("Verifying", size, progress.Bytes)
+	_, err = io.Copy(progress.Writer(h, progress.Default), f)
+	progress.Default.Finish()
+	if err != nil {
 		f.Close()
 		return "", "", fmt.Errorf("cannot compute sha256 of %s after download: %v", tmpDestPath, err)
 	}
@@ -788,15 +985,14 @@ func parseStartupOptions(baseArgs []string) []string {
 	return result
 }
 
-func shutdownIfNeeded(bazelPath string, startupOptions []string, config config.Config) {
-	bazeliskClean := config.Get("BAZELISK_SHUTDOWN")
-	if len(bazeliskClean) == 0 {
+func shutdownIfNeeded(bazelPath string, startupOptions []string, cfg config.Config) {
+	if !config.IsEnabled(cfg, "BAZELISK_SHUTDOWN") {
 		return
 	}
 
 	args := append(startupOptions, "shutdown")
 	fmt.Printf("bazel %s\n", strings.Join(args, " "))
-	exitCode, err := runBazel(bazelPath, args, nil, config)
+	exitCode, err := runBazel(bazelPath, args, nil, cfg)
 	fmt.Printf("\n")
 	if err != nil {
 		log.Fatalf("failed to run bazel shutdown: %v", err)
@@ -807,15 +1003,14 @@ func shutdownIfNeeded(bazelPath string, startupOptions []string, config config.C
 	}
 }
 
-func cleanIfNeeded(bazelPath string, startupOptions []string, config config.Config) {
-	bazeliskClean := config.Get("BAZELISK_CLEAN")
-	if len(bazeliskClean) == 0 {
+func cleanIfNeeded(bazelPath string, startupOptions []string, cfg config.Config) {
+	if !config.IsEnabled(cfg, "BAZELISK_CLEAN") {
 		return
 	}
 
 	args := append(startupOptions, "clean", "--expunge")
 	fmt.Printf("bazel %s\n", strings.Join(args, " "))
-	exitCode, err := runBazel(bazelPath, args, nil, config)
+	exitCode, err := runBazel(bazelPath, args, nil, cfg)
 	fmt.Printf("\n")
 	if err != nil {
 		log.Fatalf("failed to run clean: %v", err)
@@ -842,19 +1037,14 @@ type compareResponse struct {
 }
 
 func sendRequest(url string, config config.Config) (*http.Response, error) {
-	client := &http.Client{}
-
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, err
-	}
-
+	headers := make(map[string]string)
 	githubToken := config.Get("BAZELISK_GITHUB_TOKEN")
 	if len(githubToken) != 0 {
-		req.Header.Set("Authorization", fmt.Sprintf("token %s", githubToken))
+		headers["Authorization"] = fmt.Sprintf("token %s", githubToken)
 	}
 
-	return client.Do(req)
+	// httputil.Get also waits for the GitHub rate limit to reset, if necessary.
+	return httputil.Get(context.Background(), url, headers)
 }
 
 func getBazelCommitsBetween(oldCommit string, newCommit string, config config.Config) (string, []string, error) {
@@ -1000,7 +1190,7 @@ func bisect(oldCommit string, newCommit string, args []string, bazeliskHome stri
 }
 
 func testWithBazelAtCommit(bazelCommit string, args []string, bazeliskHome string, repos *Repositories, config config.Config) (int, error) {
-	bazelPath, err := downloadBazel(bazelCommit, bazeliskHome, repos, config)
+	bazelPath, err := downloadBazel(context.Background(), bazelCommit, bazeliskHome, repos, config)
 	if err != nil {
 		return 1, fmt.Errorf("could not download Bazel: %v", err)
 	}
@@ -1,13 +1,22 @@
 package core
 
 import (
+	"context"
 	"log"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/bazelbuild/bazelisk/config"
+	"github.com/bazelbuild/bazelisk/httputil"
+	"github.com/bazelbuild/bazelisk/platforms"
 )
 
 func TestMaybeDelegateToNoWrapper(t *testing.T) {
@@ -168,3 +177,140 @@ func TestMaybeDelegateToPowershellOverBatchWrapper(t *testing.T) {
 		t.Fatalf("Expected to delegate bazel to %q, but got %q", expected, entrypoint)
 	}
 }
+
+func newCountingBazelServer(t *testing.T, delay time.Duration) (*httptest.Server, *atomic.Int32) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		time.Sleep(delay)
+		w.Write([]byte("#!/bin/sh\necho bazel\n"))
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func TestConcurrentDownloadsAreDeduplicated(t *testing.T) {
+	server, requests := newCountingBazelServer(t, 200*time.Millisecond)
+	bazeliskHome := t.TempDir()
+	cfg := config.Static(map[string]string{httputil.DownloadLockDirEnv: t.TempDir()})
+	downloader := func(ctx context.Context, destDir, destFile string) (string, error) {
+		return httputil.DownloadBinary(ctx, server.URL, destDir, destFile, cfg)
+	}
+
+	const processes = 5
+	paths := make([]string, processes)
+	errs := make([]error, processes)
+	var wg sync.WaitGroup
+	for i := 0; i < processes; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			paths[i], errs[i] = downloadBazelIfNecessary(context.Background(), "7.0.0", bazeliskHome, "bazelbuild", &Repositories{}, cfg, downloader)
+		}()
+	}
+	wg.Wait()
+
+	for i := 0; i < processes; i++ {
+		if errs[i] != nil {
+			t.Fatalf("Download %d failed: %v", i, errs[i])
+		}
+		if paths[i] != paths[0] {
+			t.Errorf("Expected all downloads to return %s, but download %d returned %s", paths[0], i, paths[i])
+		}
+	}
+	if got := requests.Load(); got != 1 {
+		t.Errorf("Expected a single download, but got %d", got)
+	}
+}
+
+func TestDownloadLockTimeoutFallsBackToDownloading(t *testing.T) {
+	server, requests := newCountingBazelServer(t, 0)
+	bazeliskHome := t.TempDir()
+	cfg := config.Static(map[string]string{
+		httputil.DownloadLockDirEnv:     t.TempDir(),
+		httputil.DownloadLockTimeoutEnv: "100ms",
+	})
+	downloader := func(ctx context.Context, destDir, destFile string) (string, error) {
+		return httputil.DownloadBinary(ctx, server.URL, destDir, destFile, cfg)
+	}
+
+	// Simulate another process that holds the lock forever.
+	pathSegment, err := platforms.DetermineBazelFilename("7.0.0", false, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mappingPath := filepath.Join(bazeliskHome, "downloads", "metadata", "bazelbuild", pathSegment)
+	unlock, err := httputil.LockDownload(context.Background(), bazeliskHome, mappingPath, cfg)
+	if err != nil {
+		t.Fatalf("Could not acquire lock: %v", err)
+	}
+	defer unlock()
+
+	if _, err := downloadBazelIfNecessary(context.Background(), "7.0.0", bazeliskHome, "bazelbuild", &Repositories{}, cfg, downloader); err != nil {
+		t.Fatalf("Expected download to succeed despite the lock, but got %v", err)
+	}
+	if got := requests.Load(); got != 1 {
+		t.Errorf("Expected a single download, but got %d", got)
+	}
+}
+
+func TestUnreadableSystemConfigFileIsSkipped(t *testing.T) {
+	if runtime.GOOS == "windows" || os.Geteuid() == 0 {
+		t.Skip("file permissions are not enforced")
+	}
+	path := filepath.Join(t.TempDir(), "bazeliskrc")
+	if err := os.WriteFile(path, []byte("USE_BAZEL_VERSION=7.0.0\n"), 0000); err != nil {
+		t.Fatal(err)
+	}
+
+	if c, err := readConfigFile(path, true); c != nil || err != nil {
+		t.Errorf("Expected unreadable system-wide file to be skipped, but got %v, %v", c, err)
+	}
+	if _, err := readConfigFile(path, false); err == nil {
+		t.Error("Expected unreadable .bazeliskrc file to be an error")
+	}
+}
+
+func TestGetBazeliskHomeRespectsLayerPrecedence(t *testing.T) {
+	osKey := "BAZELISK_HOME_" + strings.ToUpper(runtime.GOOS)
+	tests := []struct {
+		name string
+		cfg  config.Config
+		want string
+	}{
+		{
+			name: "plain key in higher layer",
+			cfg: config.Layered(
+				config.PlatformSpecific(config.Static(map[string]string{"BAZELISK_HOME": "/env"})),
+				config.PlatformSpecific(config.Static(map[string]string{osKey: "/file"})),
+			),
+			want: "/env",
+		},
+		{
+			name: "OS-specific key in the same layer",
+			cfg:  config.PlatformSpecific(config.Static(map[string]string{"BAZELISK_HOME": "/plain", osKey: "/os"})),
+			want: "/os",
+		},
+		{
+			name: "OS-specific key without platform-specific config",
+			cfg:  config.Static(map[string]string{osKey: "/os"}),
+			want: "/os",
+		},
+		{
+			name: "both keys without platform-specific config",
+			cfg:  config.Static(map[string]string{"BAZELISK_HOME": "/plain", osKey: "/os"}),
+			want: "/os",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := getBazeliskHome(tc.cfg)
+			if err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("Expected %s, but got %s", tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/bazelbuild/bazelisk/config"
+)
+
+const printConfigFlag = "--print_config"
+
+// configEntry describes the effective value of a known config key in the output of --print_config.
+type configEntry struct {
+	Name        string          `json:"name"`
+	Type        string          `json:"type"`
+	Description string          `json:"description"`
+	Set         bool            `json:"set"`
+	Value       string          `json:"value,omitempty"`
+	Location    string          `json:"location,omitempty"`
+	Key         string          `json:"key,omitempty"`
+	Shadowed    []config.Source `json:"shadowed,omitempty"`
+}
+
+// PrintConfigIfRequested handles --print_config, which must be the first of the given command-line arguments, and
+// returns whether it did. It doesn't depend on the Bazel version, which might not even be resolvable with a broken
+// config, so callers should invoke it before resolving the version.
+func PrintConfigIfRequested(args []string, c config.Config, out io.Writer) (bool, error) {
+	if len(args) == 0 || (args[0] != printConfigFlag && !strings.HasPrefix(args[0], printConfigFlag+"=")) {
+		return false, nil
+	}
+	return true, printConfig(args[0], c, out)
+}
+
+// printConfig writes the effective value of every known key, where it was set and which values it shadows.
+// The flag value "json" selects JSON output.
+func printConfig(arg string, c config.Config, out io.Writer) error {
+	format := strings.TrimPrefix(strings.TrimPrefix(arg, printConfigFlag), "=")
+	if format != "" && format != "text" && format != "json" {
+		return fmt.Errorf("invalid value %q for %s: must be text or json", format, printConfigFlag)
+	}
+
+	entries := make([]configEntry, 0, len(config.Schema))
+	for _, key := range config.Schema {
+		entry := configEntry{Name: key.Name, Type: key.Type.String(), Description: key.Description}
+		sources := config.Sources(c, key.Name)
+		for i := range sources {
+			sources[i].Value = redactValue(key, sources[i].Value)
+		}
+		if len(sources) > 0 {
+			entry.Set = true
+			entry.Value = sources[0].Value
+			entry.Location = sources[0].Location
+			entry.Key = sources[0].Key
+			entry.Shadowed = sources[1:]
+		}
+		entries = append(entries, entry)
+	}
+
+	if format == "json" {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(entries)
+	}
+
+	for _, entry := range entries {
+		if !entry.Set {
+			fmt.Fprintf(out, "%s is not set\n", entry.Name)
+			continue
+		}
+		fmt.Fprintf(out, "%s=%q%s\n", entry.Name, entry.Value, formatSource(entry.Location, entry.Key))
+		for _, s := range entry.Shadowed {
+			fmt.Fprintf(out, "    shadows %q%s\n", s.Value, formatSource(s.Location, s.Key))
+		}
+	}
+	return nil
+}
+
+// redactValue hides secrets, as well as credentials that are embedded in URLs such as the proxy URL.
+func redactValue(key config.Key, value string) string {
+	if key.Type == config.Secret {
+		return "<redacted>"
+	}
+	if u, err := url.Parse(value); err == nil && u.User != nil {
+		return u.Redacted()
+	}
+	return value
+}
+
+func formatSource(location, key string) string {
+	var parts []string
+	if location != "" {
+		parts = append(parts, location)
+	}
+	if key != "" {
+		parts = append(parts, "as "+key)
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" (%s)", strings.Join(parts, ", "))
+}
@@ -1,14 +1,17 @@
 package core
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"slices"
 	"strings"
 
 	"github.com/bazelbuild/bazelisk/config"
 	"github.com/bazelbuild/bazelisk/httputil"
 	"github.com/bazelbuild/bazelisk/platforms"
 	"github.com/bazelbuild/bazelisk/versions"
+	"github.com/hashicorp/go-version"
 )
 
 const (
@@ -20,7 +23,7 @@ const (
 )
 
 // DownloadFunc downloads a specific Bazel binary to the given location and returns the absolute path.
-type DownloadFunc func(destDir, destFile string) (string, error)
+type DownloadFunc func(ctx context.Context, destDir, destFile string) (string, error)
 
 // LTSFilter filters Bazel versions based on specific criteria.
 type LTSFilter func(string) bool
@@ -29,45 +32,50 @@ type LTSFilter func(string) bool
 type FilterOpts struct {
 	MaxResults int
 	Track      int
-	Filter     LTSFilter
+	// MinorTrack restricts the minor version within Track if HasMinorTrack is true.
+	HasMinorTrack bool
+	MinorTrack    int
+	Filter        LTSFilter
+	// Constraints, if set, restrict the base versions (X.Y.Z) whose releases and candidates are considered.
+	Constraints version.Constraints
 }
 
 // LTSRepo represents a repository that stores LTS Bazel releases and their candidates.
 type LTSRepo interface {
 	// GetLTSVersions returns a list of all available LTS release (candidates) that match the given filter options.
 	// Warning: Filters only work reliably if the versions are processed in descending order!
-	GetLTSVersions(bazeliskHome string, opts *FilterOpts) ([]string, error)
+	GetLTSVersions(ctx context.Context, bazeliskHome string, opts *FilterOpts) ([]string, error)
 
 	// DownloadLTS downloads the given Bazel version into the specified location and returns the absolute path.
-	DownloadLTS(version, destDir, destFile string, config config.Config) (string, error)
+	DownloadLTS(ctx context.Context, version, destDir, destFile string, config config.Config) (string, error)
 }
 
 // ForkRepo represents a repository that stores a fork of Bazel (releases).
 type ForkRepo interface {
 	// GetVersions returns the versions of all available Bazel binaries in the given fork.
-	GetVersions(bazeliskHome, fork string) ([]string, error)
+	GetVersions(ctx context.Context, bazeliskHome, fork string) ([]string, error)
 
 	// DownloadVersion downloads the given Bazel binary from the specified fork into the given location and returns the absolute path.
-	DownloadVersion(fork, version, destDir, destFile string, config config.Config) (string, error)
+	DownloadVersion(ctx context.Context, fork, version, destDir, destFile string, config config.Config) (string, error)
 }
 
 // CommitRepo represents a repository that stores Bazel binaries built at specific commits.
 // It can also return the hashes of the most recent commits that passed Bazel CI pipelines successfully.
 type CommitRepo interface {
 	// GetLastGreenCommit returns the most recent commit at which a Bazel binary is successfully built.
-	GetLastGreenCommit(bazeliskHome string) (string, error)
+	GetLastGreenCommit(ctx context.Context, bazeliskHome string) (string, error)
 
 	// DownloadAtCommit downloads a Bazel binary built at the given commit into the specified location and returns the absolute path.
-	DownloadAtCommit(commit, destDir, destFile string, config config.Config) (string, error)
+	DownloadAtCommit(ctx context.Context, commit, destDir, destFile string, config config.Config) (string, error)
 }
 
 // RollingRepo represents a repository that stores rolling Bazel releases.
 type RollingRepo interface {
 	// GetRollingVersions returns a list of all available rolling release versions.
-	GetRollingVersions(bazeliskHome string) ([]string, error)
+	GetRollingVersions(ctx context.Context, bazeliskHome string) ([]string, error)
 
 	// DownloadRolling downloads the given Bazel version into the specified location and returns the absolute path.
-	DownloadRolling(version, destDir, destFile string, config config.Config) (string, error)
+	DownloadRolling(ctx context.Context, version, destDir, destFile string, config config.Config) (string, error)
 }
 
 // Repositories offers access to different types of Bazel repositories, mainly for finding and downloading the correct version of Bazel.
@@ -80,38 +88,38 @@ type Repositories struct {
 }
 
 // ResolveVersion resolves a potentially relative Bazel version string such as "latest" to an absolute version identifier, and returns this identifier alongside a function to download said version.
-func (r *Repositories) ResolveVersion(bazeliskHome, fork, version string, config config.Config) (string, DownloadFunc, error) {
+func (r *Repositories) ResolveVersion(ctx context.Context, bazeliskHome, fork, version string, config config.Config) (string, DownloadFunc, error) {
 	vi, err := versions.Parse(fork, version)
 	if err != nil {
 		return "", nil, err
 	}
 
 	if vi.IsFork {
-		return r.resolveFork(bazeliskHome, vi, config)
+		return r.resolveFork(ctx, bazeliskHome, vi, config)
 	} else if vi.IsLTS {
-		return r.resolveLTS(bazeliskHome, vi, config)
+		return r.resolveLTS(ctx, bazeliskHome, vi, config)
 	} else if vi.IsCommit {
-		return r.resolveCommit(bazeliskHome, vi, config)
+		return r.resolveCommit(ctx, bazeliskHome, vi, config)
 	} else if vi.IsRolling {
-		return r.resolveRolling(bazeliskHome, vi, config)
+		return r.resolveRolling(ctx, bazeliskHome, vi, config)
 	}
 
 	return "", nil, fmt.Errorf("unsupported version identifier '%s'", version)
 }
 
-func (r *Repositories) resolveFork(bazeliskHome string, vi *versions.Info, config config.Config) (string, DownloadFunc, error) {
+func (r *Repositories) resolveFork(ctx context.Context, bazeliskHome string, vi *versions.Info, config config.Config) (string, DownloadFunc, error) {
 	if vi.IsRelative && (vi.MustBeCandidate || vi.IsCommit) {
 		return "", nil, errors.New("forks do not support last_rc and last_green")
 	}
-	lister := func(bazeliskHome string) ([]string, error) {
-		return r.Fork.GetVersions(bazeliskHome, vi.Fork)
+	lister := func(ctx context.Context, bazeliskHome string) ([]string, error) {
+		return r.Fork.GetVersions(ctx, bazeliskHome, vi.Fork)
 	}
-	version, err := resolvePotentiallyRelativeVersion(bazeliskHome, lister, vi)
+	version, err := resolvePotentiallyRelativeVersion(ctx, bazeliskHome, lister, vi)
 	if err != nil {
 		return "", nil, err
 	}
-	downloader := func(destDir, destFile string) (string, error) {
-		return r.Fork.DownloadVersion(vi.Fork, version, destDir, destFile, config)
+	downloader := func(ctx context.Context, destDir, destFile string) (string, error) {
+		return r.Fork.DownloadVersion(ctx, vi.Fork, version, destDir, destFile, config)
 	}
 	return version, downloader, nil
 }
@@ -124,11 +132,14 @@ var IsCandidate = func(version string) bool {
 	return strings.Contains(version, "rc")
 }
 
-func (r *Repositories) resolveLTS(bazeliskHome string, vi *versions.Info, config config.Config) (string, DownloadFunc, error) {
+func (r *Repositories) resolveLTS(ctx context.Context, bazeliskHome string, vi *versions.Info, config config.Config) (string, DownloadFunc, error) {
 	opts := &FilterOpts{
 		// Optimization: only fetch last (x+1) releases if the version is "latest-x".
-		MaxResults: vi.LatestOffset + 1,
-		Track:      vi.TrackRestriction,
+		MaxResults:    vi.LatestOffset + 1,
+		Track:         vi.TrackRestriction,
+		HasMinorTrack: vi.HasMinorTrack,
+		MinorTrack:    vi.MinorTrackRestriction,
+		Constraints:   vi.Constraints,
 	}
 
 	if vi.MustBeRelease {
@@ -140,70 +151,97 @@ func (r *Repositories) resolveLTS(bazeliskHome string, vi *versions.Info, config
 		opts.Filter = func(v string) bool { return true }
 	}
 
-	lister := func(bazeliskHome string) ([]string, error) {
-		return r.LTS.GetLTSVersions(bazeliskHome, opts)
+	lister := func(ctx context.Context, bazeliskHome string) ([]string, error) {
+		return r.LTS.GetLTSVersions(ctx, bazeliskHome, opts)
 	}
-	version, err := resolvePotentiallyRelativeVersion(bazeliskHome, lister, vi)
+	version, err := resolvePotentiallyRelativeVersion(ctx, bazeliskHome, lister, vi)
 	if err != nil {
 		return "", nil, err
 	}
-	downloader := func(destDir, destFile string) (string, error) {
-		return r.LTS.DownloadLTS(version, destDir, destFile, config)
+	downloader := func(ctx context.Context, destDir, destFile string) (string, error) {
+		return r.LTS.DownloadLTS(ctx, version, destDir, destFile, config)
 	}
 	return version, downloader, nil
 }
 
-func (r *Repositories) resolveCommit(bazeliskHome string, vi *versions.Info, config config.Config) (string, DownloadFunc, error) {
+func (r *Repositories) resolveCommit(ctx context.Context, bazeliskHome string, vi *versions.Info, config config.Config) (string, DownloadFunc, error) {
 	version := vi.Value
 	if vi.IsRelative {
 		var err error
-		version, err = r.Commits.GetLastGreenCommit(bazeliskHome)
+		version, err = r.Commits.GetLastGreenCommit(ctx, bazeliskHome)
 		if err != nil {
 			return "", nil, fmt.Errorf("cannot resolve last green commit: %v", err)
 		}
 	}
-	downloader := func(destDir, destFile string) (string, error) {
-		return r.Commits.DownloadAtCommit(version, destDir, destFile, config)
+	downloader := func(ctx context.Context, destDir, destFile string) (string, error) {
+		return r.Commits.DownloadAtCommit(ctx, version, destDir, destFile, config)
 	}
 	return version, downloader, nil
 }
 
-func (r *Repositories) resolveRolling(bazeliskHome string, vi *versions.Info, config config.Config) (string, DownloadFunc, error) {
-	lister := func(bazeliskHome string) ([]string, error) {
-		return r.Rolling.GetRollingVersions(bazeliskHome)
+func (r *Repositories) resolveRolling(ctx context.Context, bazeliskHome string, vi *versions.Info, config config.Config) (string, DownloadFunc, error) {
+	lister := func(ctx context.Context, bazeliskHome string) ([]string, error) {
+		return r.Rolling.GetRollingVersions(ctx, bazeliskHome)
 	}
-	version, err := resolvePotentiallyRelativeVersion(bazeliskHome, lister, vi)
+	version, err := resolvePotentiallyRelativeVersion(ctx, bazeliskHome, lister, vi)
 	if err != nil {
 		return "", nil, err
 	}
-	downloader := func(destDir, destFile string) (string, error) {
-		return r.Rolling.DownloadRolling(version, destDir, destFile, config)
+	downloader := func(ctx context.Context, destDir, destFile string) (string, error) {
+		return r.Rolling.DownloadRolling(ctx, version, destDir, destFile, config)
 	}
 	return version, downloader, nil
 }
 
-type listVersionsFunc func(bazeliskHome string) ([]string, error)
+type listVersionsFunc func(ctx context.Context, bazeliskHome string) ([]string, error)
 
-func resolvePotentiallyRelativeVersion(bazeliskHome string, lister listVersionsFunc, vi *versions.Info) (string, error) {
+// VersionNotFoundError indicates that no Bazel version matches the requested one, as opposed to errors that prevent
+// finding out, such as network failures.
+type VersionNotFoundError struct {
+	Message string
+}
+
+func (e *VersionNotFoundError) Error() string {
+	return e.Message
+}
+
+func resolvePotentiallyRelativeVersion(ctx context.Context, bazeliskHome string, lister listVersionsFunc, vi *versions.Info) (string, error) {
 	if !vi.IsRelative {
 		return vi.Value, nil
 	}
 
-	available, err := lister(bazeliskHome)
+	available, err := lister(ctx, bazeliskHome)
 	if err != nil {
-		return "", fmt.Errorf("unable to determine latest version: %v", err)
+		return "", fmt.Errorf("unable to determine latest version: %w", err)
+	}
+	if vi.Constraints != nil || vi.HasMinorTrack {
+		// Not all listers support constraints and minor tracks, e.g. those of forks.
+		available = slices.DeleteFunc(slices.Clone(available), func(v string) bool {
+			parsed, err := version.NewVersion(v)
+			if err != nil {
+				return true
+			}
+			if vi.HasMinorTrack {
+				segments := parsed.Segments()
+				return segments[0] != vi.TrackRestriction || segments[1] != vi.MinorTrackRestriction
+			}
+			return !vi.Constraints.Check(parsed)
+		})
+		if len(available) == 0 {
+			return "", &VersionNotFoundError{fmt.Sprintf("cannot resolve version %q: There are no matching Bazel releases", vi.Value)}
+		}
 	}
 
 	index := len(available) - 1 - vi.LatestOffset
 	if index < 0 {
-		return "", fmt.Errorf("cannot resolve version %q: There are not enough matching Bazel releases (%d)", vi.Value, len(available))
+		return "", &VersionNotFoundError{fmt.Sprintf("cannot resolve version %q: There are not enough matching Bazel releases (%d)", vi.Value, len(available))}
 	}
 	sorted := versions.GetInAscendingOrder(available)
 	return sorted[index], nil
 }
 
 // DownloadFromBaseURL can download Bazel binaries from a specific URL while ignoring the predefined repositories.
-func (r *Repositories) DownloadFromBaseURL(baseURL, version, destDir, destFile string, config config.Config) (string, error) {
+func (r *Repositories) DownloadFromBaseURL(ctx context.Context, baseURL, version, destDir, destFile string, config config.Config) (string, error) {
 	if !r.supportsBaseURL {
 		return "", fmt.Errorf("downloads from %s are forbidden", BaseURLEnv)
 	} else if baseURL == "" {
@@ -216,7 +254,7 @@ func (r *Repositories) DownloadFromBaseURL(baseURL, version, destDir, destFile s
 	}
 
 	url := fmt.Sprintf("%s/%s/%s", baseURL, version, srcFile)
-	return httputil.DownloadBinary(url, destDir, destFile, config)
+	return httputil.DownloadBinary(ctx, url, destDir, destFile, config)
 }
 
 // BuildURLFromFormat returns a Bazel download URL based on formatURL.
@@ -266,7 +304,7 @@ func BuildURLFromFormat(config config.Config, formatURL, version string) (string
 }
 
 // DownloadFromFormatURL can download Bazel binaries from a specific URL while ignoring the predefined repositories.
-func (r *Repositories) DownloadFromFormatURL(config config.Config, formatURL, version, destDir, destFile string) (string, error) {
+func (r *Repositories) DownloadFromFormatURL(ctx context.Context, config config.Config, formatURL, version, destDir, destFile string) (string, error) {
 	if formatURL == "" {
 		return "", fmt.Errorf("%s is not set", FormatURLEnv)
 	}
@@ -276,7 +314,7 @@ func (r *Repositories) DownloadFromFormatURL(config config.Config, formatURL, ve
 		return "", err
 	}
 
-	return httputil.DownloadBinary(url, destDir, destFile, config)
+	return httputil.DownloadBinary(ctx, url, destDir, destFile, config)
 }
 
 // CreateRepositories creates a new Repositories instance with the given repositories. Any nil repository will be replaced by a dummy repository that raises an error whenever a download is attempted.
@@ -317,11 +355,11 @@ type noLTSRepo struct {
 	err error
 }
 
-func (nolts *noLTSRepo) GetLTSVersions(bazeliskHome string, opts *FilterOpts) ([]string, error) {
+func (nolts *noLTSRepo) GetLTSVersions(ctx context.Context, bazeliskHome string, opts *FilterOpts) ([]string, error) {
 	return nil, nolts.err
 }
 
-func (nolts *noLTSRepo) DownloadLTS(version, destDir, destFile string, config config.Config) (string, error) {
+func (nolts *noLTSRepo) DownloadLTS(ctx context.Context, version, destDir, destFile string, config config.Config) (string, error) {
 	return "", nolts.err
 }
 
@@ -329,11 +367,11 @@ type noForkRepo struct {
 	err error
 }
 
-func (nfr *noForkRepo) GetVersions(bazeliskHome, fork string) ([]string, error) {
+func (nfr *noForkRepo) GetVersions(ctx context.Context, bazeliskHome, fork string) ([]string, error) {
 	return nil, nfr.err
 }
 
-func (nfr *noForkRepo) DownloadVersion(fork, version, destDir, destFile string, config config.Config) (string, error) {
+func (nfr *noForkRepo) DownloadVersion(ctx context.Context, fork, version, destDir, destFile string, config config.Config) (string, error) {
 	return "", nfr.err
 }
 
@@ -341,11 +379,11 @@ type noCommitRepo struct {
 	err error
 }
 
-func (nlgr *noCommitRepo) GetLastGreenCommit(bazeliskHome string) (string, error) {
+func (nlgr *noCommitRepo) GetLastGreenCommit(ctx context.Context, bazeliskHome string) (string, error) {
 	return "", nlgr.err
 }
 
-func (nlgr *noCommitRepo) DownloadAtCommit(commit, destDir, destFile string, config config.Config) (string, error) {
+func (nlgr *noCommitRepo) DownloadAtCommit(ctx context.Context, commit, destDir, destFile string, config config.Config) (string, error) {
 	return "", nlgr.err
 }
 
@@ -353,10 +391,10 @@ type noRollingRepo struct {
 	err error
 }
 
-func (nrr *noRollingRepo) GetRollingVersions(bazeliskHome string) ([]string, error) {
+func (nrr *noRollingRepo) GetRollingVersions(ctx context.Context, bazeliskHome string) ([]string, error) {
 	return nil, nrr.err
 }
 
-func (nrr *noRollingRepo) DownloadRolling(version, destDir, destFile string, config config.Config) (string, error) {
+func (nrr *noRollingRepo) DownloadRolling(ctx context.Context, version, destDir, destFile string, config config.Config) (string, error) {
 	return "", nrr.err
 }
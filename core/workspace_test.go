@@ -0,0 +1,133 @@
+package core
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/bazelbuild/bazelisk/config"
+	"github.com/bazelbuild/bazelisk/httputil"
+)
+
+func writeWorkspaceFile(t *testing.T, path, contents string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConfigAndVersionForWorkspace(t *testing.T) {
+	for _, name := range []string{"USE_BAZEL_VERSION", "BAZELISK_NOJDK"} {
+		if _, ok := os.LookupEnv(name); ok {
+			t.Skipf("%s is set in the environment", name)
+		}
+	}
+
+	first := t.TempDir()
+	writeWorkspaceFile(t, filepath.Join(first, "MODULE.bazel"), "")
+	writeWorkspaceFile(t, filepath.Join(first, ".bazelversion"), "7.1.0\n")
+	writeWorkspaceFile(t, filepath.Join(first, "team", ".bazeliskrc"), "BAZELISK_NOJDK=1\n")
+
+	second := t.TempDir()
+	writeWorkspaceFile(t, filepath.Join(second, "WORKSPACE"), "")
+	writeWorkspaceFile(t, filepath.Join(second, ".bazeliskrc"), "USE_BAZEL_VERSION=6.5.0\n")
+
+	tests := []struct {
+		dir         string
+		wantVersion string
+		wantNojdk   string
+	}{
+		{dir: filepath.Join(first, "team"), wantVersion: "7.1.0", wantNojdk: "1"},
+		{dir: first, wantVersion: "7.1.0", wantNojdk: ""},
+		{dir: second, wantVersion: "6.5.0", wantNojdk: ""},
+	}
+	for _, tc := range tests {
+		c, err := MakeConfigForWorkspace(tc.dir)
+		if err != nil {
+			t.Fatalf("Could not make config for %s: %v", tc.dir, err)
+		}
+		if got := c.Get("BAZELISK_NOJDK"); got != tc.wantNojdk {
+			t.Errorf("Expected BAZELISK_NOJDK=%q in %s, but got %q", tc.wantNojdk, tc.dir, got)
+		}
+		version, err := GetBazelVersionForWorkspace(c, tc.dir)
+		if err != nil {
+			t.Fatalf("Could not get version for %s: %v", tc.dir, err)
+		}
+		if version != tc.wantVersion {
+			t.Errorf("Expected version %s in %s, but got %s", tc.wantVersion, tc.dir, version)
+		}
+	}
+}
+
+func TestVersionForRelativeWorkspaceDirectory(t *testing.T) {
+	if _, ok := os.LookupEnv("USE_BAZEL_VERSION"); ok {
+		t.Skip("USE_BAZEL_VERSION is set in the environment")
+	}
+
+	workspace := t.TempDir()
+	writeWorkspaceFile(t, filepath.Join(workspace, "MODULE.bazel"), "")
+	writeWorkspaceFile(t, filepath.Join(workspace, ".bazelversion"), "7.1.0\n")
+	writeWorkspaceFile(t, filepath.Join(workspace, "team", "BUILD"), "")
+
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(filepath.Join(workspace, "team")); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(oldDir) })
+
+	// The workspace root is above the relative directory, so it can only be found via the absolute path.
+	version, err := GetBazelVersionForWorkspace(config.Null(), ".")
+	if err != nil {
+		t.Fatalf("Could not get version: %v", err)
+	}
+	if version != "7.1.0" {
+		t.Errorf("Expected version 7.1.0, but got %s", version)
+	}
+}
+
+func TestInstallationAppliesHTTPConfig(t *testing.T) {
+	if _, ok := os.LookupEnv("USE_BAZEL_VERSION"); ok {
+		t.Skip("USE_BAZEL_VERSION is set in the environment")
+	}
+	previous := httputil.UserAgent
+	t.Cleanup(func() { httputil.UserAgent = previous })
+
+	var userAgent atomic.Value
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgent.Store(r.UserAgent())
+		w.Write([]byte("#!/bin/sh\necho bazel\n"))
+	}))
+	t.Cleanup(server.Close)
+
+	workspace := t.TempDir()
+	writeWorkspaceFile(t, filepath.Join(workspace, "MODULE.bazel"), "")
+	writeWorkspaceFile(t, filepath.Join(workspace, ".bazelversion"), "7.0.0\n")
+	cfg := config.Static(map[string]string{
+		"BAZELISK_HOME":       t.TempDir(),
+		"BAZELISK_USER_AGENT": "embedder/1.0",
+		BaseURLEnv:            server.URL,
+	})
+
+	if _, err := GetBazelInstallationForWorkspace(context.Background(), CreateRepositories(nil, nil, nil, nil, true), cfg, workspace); err != nil {
+		t.Fatalf("Could not get installation: %v", err)
+	}
+	if got := userAgent.Load(); got != "embedder/1.0" {
+		t.Errorf("Expected the configured user agent, but got %v", got)
+	}
+
+	invalid := config.Static(map[string]string{"BAZELISK_CONNECT_TIMEOUT": "soon"})
+	if _, err := GetBazelInstallationForWorkspace(context.Background(), CreateRepositories(nil, nil, nil, nil, true), invalid, workspace); err == nil || !strings.Contains(err.Error(), "could not configure HTTP client") {
+		t.Errorf("Expected an invalid HTTP config to be rejected, but got %v", err)
+	}
+}
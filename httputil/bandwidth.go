@@ -0,0 +1,109 @@
+package httputil
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bazelbuild/bazelisk/config"
+)
+
+const (
+	// MaxBandwidthEnv is the name of the config value that limits the download speed of binaries in bytes per second.
+	// The value may have one of the suffixes "K", "M" or "G", e.g. "10M".
+	MaxBandwidthEnv = "BAZELISK_MAX_BANDWIDTH"
+)
+
+// bandwidthLimiter limits the combined throughput of all readers that it wraps.
+type bandwidthLimiter struct {
+	bytesPerSecond int64
+
+	mu          sync.Mutex
+	start       time.Time
+	transferred int64
+}
+
+// newBandwidthLimiter returns a limiter for the bandwidth from the config, or nil if there is no limit.
+func newBandwidthLimiter(config config.Config) (*bandwidthLimiter, error) {
+	value := config.Get(MaxBandwidthEnv)
+	if value == "" {
+		return nil, nil
+	}
+	bytesPerSecond, err := parseBandwidth(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value %q for %s: %v", value, MaxBandwidthEnv, err)
+	}
+	return &bandwidthLimiter{bytesPerSecond: bytesPerSecond, start: time.Now()}, nil
+}
+
+func parseBandwidth(value string) (int64, error) {
+	multiplier := int64(1)
+	switch strings.ToUpper(value[len(value)-1:]) {
+	case "K":
+		multiplier = 1024
+	case "M":
+		multiplier = 1024 * 1024
+	case "G":
+		multiplier = 1024 * 1024 * 1024
+	}
+	if multiplier > 1 {
+		value = value[:len(value)-1]
+	}
+	number, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || number <= 0 {
+		return 0, fmt.Errorf("must be a positive number of bytes per second, optionally followed by K, M or G")
+	}
+	return number * multiplier, nil
+}
+
+// reader wraps the given reader so that it is subject to the bandwidth limit. A nil limiter returns the reader unchanged.
+// Reads fail as soon as the context is done, even if they are still waiting for the limit.
+func (bl *bandwidthLimiter) reader(ctx context.Context, r io.Reader) io.Reader {
+	if bl == nil {
+		return r
+	}
+	return &throttledReader{ctx: ctx, r: r, limiter: bl}
+}
+
+// wait blocks until the given number of additional bytes fit into the bandwidth limit or the context is done.
+func (bl *bandwidthLimiter) wait(ctx context.Context, n int) error {
+	bl.mu.Lock()
+	bl.transferred += int64(n)
+	due := bl.start.Add(time.Duration(float64(bl.transferred) / float64(bl.bytesPerSecond) * float64(time.Second)))
+	bl.mu.Unlock()
+
+	d := time.Until(due)
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+type throttledReader struct {
+	ctx     context.Context
+	r       io.Reader
+	limiter *bandwidthLimiter
+}
+
+func (tr *throttledReader) Read(p []byte) (int, error) {
+	// Read in small portions so that the download proceeds smoothly instead of in bursts.
+	if limit := tr.limiter.bytesPerSecond / 10; limit > 0 && int64(len(p)) > limit {
+		p = p[:limit]
+	}
+	n, err := tr.r.Read(p)
+	if waitErr := tr.limiter.wait(tr.ctx, n); waitErr != nil {
+		return n, waitErr
+	}
+	return n, err
+}
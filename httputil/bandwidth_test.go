@@ -0,0 +1,86 @@
+package httputil
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bazelbuild/bazelisk/config"
+)
+
+func TestParseBandwidth(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int64
+		wantErr bool
+	}{
+		{value: "1000", want: 1000},
+		{value: "10K", want: 10 * 1024},
+		{value: "10k", want: 10 * 1024},
+		{value: "5M", want: 5 * 1024 * 1024},
+		{value: "1G", want: 1024 * 1024 * 1024},
+		{value: "M", wantErr: true},
+		{value: "0", wantErr: true},
+		{value: "-5K", wantErr: true},
+		{value: "fast", wantErr: true},
+	}
+	for _, tc := range tests {
+		got, err := parseBandwidth(tc.value)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("parseBandwidth(%q): expected error, but got %d", tc.value, got)
+			}
+			continue
+		}
+		if err != nil || got != tc.want {
+			t.Errorf("parseBandwidth(%q): expected %d, but got %d (%v)", tc.value, tc.want, got, err)
+		}
+	}
+}
+
+func TestDownloadBinaryRespectsBandwidthLimit(t *testing.T) {
+	content := strings.Repeat("x", 8*1024)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(content))
+	}))
+	defer server.Close()
+	setUpRealTransport(t)
+
+	start := time.Now()
+	cfg := config.Static(map[string]string{MaxBandwidthEnv: "32K"})
+	if _, err := DownloadBinary(context.Background(), server.URL, t.TempDir(), "bazel", cfg); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	// 8 KB at 32 KB/s take at least 250ms.
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("Expected download to be throttled, but it took only %v", elapsed)
+	}
+}
+
+func TestInvalidBandwidthLimit(t *testing.T) {
+	setUp()
+	_, err := DownloadBinary(context.Background(), "http://foo/bazel", t.TempDir(), "bazel", config.Static(map[string]string{MaxBandwidthEnv: "fast"}))
+	if err == nil || !strings.Contains(err.Error(), MaxBandwidthEnv) {
+		t.Fatalf("Expected error about %s, but got %v", MaxBandwidthEnv, err)
+	}
+}
+
+func TestBandwidthLimitObeysContext(t *testing.T) {
+	limiter := &bandwidthLimiter{bytesPerSecond: 1, start: time.Now()}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := io.ReadAll(limiter.reader(ctx, strings.NewReader(strings.Repeat("x", 100))))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected the context deadline to abort the read, but got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected the read to stop when the context is done, but it took %v", elapsed)
+	}
+}
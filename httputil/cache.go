@@ -0,0 +1,131 @@
+package httputil
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// ListingTTLEnv is the name of the config value that overrides ListingTTL, e.g. "10m".
+	ListingTTLEnv = "BAZELISK_LISTING_TTL"
+)
+
+var (
+	// ListingTTL specifies how long cached listings of GitHub releases are used without any request.
+	// Afterwards, Bazelisk sends a conditional request to check whether the listing has changed.
+	ListingTTL = time.Hour
+
+	errNotModified = errors.New("not modified")
+)
+
+// cacheValidators contains the headers that are needed to send conditional requests for a cached response.
+type cacheValidators struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+}
+
+func validatorsFromHeaders(headers http.Header) *cacheValidators {
+	v := &cacheValidators{
+		ETag:         headers.Get("ETag"),
+		LastModified: headers.Get("Last-Modified"),
+	}
+	if v.ETag == "" && v.LastModified == "" {
+		return nil
+	}
+	return v
+}
+
+// apply returns a copy of the given headers that turns a request into a conditional request.
+func (v *cacheValidators) apply(headers map[string]string) map[string]string {
+	if v == nil {
+		return headers
+	}
+	result := maps.Clone(headers)
+	if result == nil {
+		result = make(map[string]string)
+	}
+	if v.ETag != "" {
+		result["If-None-Match"] = v.ETag
+	}
+	if v.LastModified != "" {
+		result["If-Modified-Since"] = v.LastModified
+	}
+	return result
+}
+
+// ReadCachedRemoteFile returns the contents of the given URL and caches them under bazeliskHome.
+// Cached contents that are younger than ttl are returned without any request.
+// Older contents are revalidated with a conditional request, so that the body is only downloaded if it has changed.
+func ReadCachedRemoteFile(ctx context.Context, bazeliskHome, url, filename string, ttl time.Duration) ([]byte, error) {
+	return readThroughCache(filepath.Join(bazeliskHome, filename), ttl, func(validators *cacheValidators) ([]byte, *cacheValidators, error) {
+		body, headers, err := ReadRemoteFileWithHeaders(ctx, url, validators.apply(nil))
+		if err != nil {
+			return nil, nil, err
+		}
+		return body, validatorsFromHeaders(headers), nil
+	})
+}
+
+// readThroughCache returns the contents of cachePath if they are younger than ttl.
+// Otherwise it calls fetch with the validators of the cached contents, if there are any.
+// If fetch returns errNotModified, the cached contents are marked as fresh and returned.
+// Any other result of fetch replaces the cached contents.
+func readThroughCache(cachePath string, ttl time.Duration, fetch func(*cacheValidators) ([]byte, *cacheValidators, error)) ([]byte, error) {
+	validatorsPath := cachePath + ".validators"
+	cached, cacheErr := os.ReadFile(cachePath)
+	if cacheErr == nil {
+		if stat, err := os.Stat(cachePath); err == nil && ttl > 0 && time.Since(stat.ModTime()) < ttl {
+			return cached, nil
+		}
+	}
+
+	var validators *cacheValidators
+	if cacheErr == nil {
+		validators = readValidators(validatorsPath)
+	}
+
+	contents, newValidators, err := fetch(validators)
+	if errors.Is(err, errNotModified) {
+		now := time.Now()
+		if err := os.Chtimes(cachePath, now, now); err != nil {
+			return nil, fmt.Errorf("could not refresh %s: %v", cachePath, err)
+		}
+		return cached, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(cachePath), 0755); err != nil {
+		return nil, fmt.Errorf("could not create directory %s: %v", filepath.Dir(cachePath), err)
+	}
+	if err := os.WriteFile(cachePath, contents, 0666); err != nil {
+		return nil, fmt.Errorf("could not create %s: %v", cachePath, err)
+	}
+	if newValidators == nil {
+		os.Remove(validatorsPath)
+	} else if data, err := json.Marshal(newValidators); err == nil {
+		// Failing to store the validators only means that the next request cannot be conditional.
+		os.WriteFile(validatorsPath, data, 0666)
+	}
+	return contents, nil
+}
+
+func readValidators(path string) *cacheValidators {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var v cacheValidators
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil
+	}
+	return &v
+}
@@ -0,0 +1,144 @@
+package httputil
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bazelbuild/bazelisk/httputil/progress"
+)
+
+type conditionalServer struct {
+	body string
+	etag string
+
+	requests    int
+	conditional int
+}
+
+func (cs *conditionalServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	cs.requests++
+	if r.Header.Get("If-None-Match") != "" {
+		cs.conditional++
+		if r.Header.Get("If-None-Match") == cs.etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+	w.Header().Set("ETag", cs.etag)
+	w.Write([]byte(cs.body))
+}
+
+func setUpCache(t *testing.T, ttl time.Duration) {
+	setUpRealTransport(t)
+	oldTTL := ListingTTL
+	t.Cleanup(func() {
+		ListingTTL = oldTTL
+	})
+	ListingTTL = ttl
+}
+
+func TestMaybeDownloadSendsConditionalRequest(t *testing.T) {
+	cs := &conditionalServer{body: "[1, 2]", etag: `"v1"`}
+	server := httptest.NewServer(cs)
+	defer server.Close()
+	setUpCache(t, 0)
+
+	merges := 0
+	merger := func(chunks [][]byte) ([]byte, error) {
+		merges++
+		return chunks[0], nil
+	}
+	home := t.TempDir()
+	for i := 0; i < 2; i++ {
+		got, err := MaybeDownload(context.Background(), home, server.URL, "releases.json", "releases", "", merger)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if string(got) != cs.body {
+			t.Errorf("Expected %q, but got %q", cs.body, got)
+		}
+	}
+	if cs.requests != 2 || cs.conditional != 1 {
+		t.Errorf("Expected one regular and one conditional request, but got %d requests, %d of which were conditional", cs.requests, cs.conditional)
+	}
+	if merges != 1 {
+		t.Errorf("Expected unchanged listing not to be merged again, but got %d merges", merges)
+	}
+}
+
+func TestMaybeDownloadReportsPages(t *testing.T) {
+	server := newPaginatedServer(t, nil)
+	defer server.Close()
+	setUpCache(t, 0)
+
+	var out bytes.Buffer
+	oldDefault, oldInterval := progress.Default, progress.RedrawInterval
+	t.Cleanup(func() {
+		progress.Default, progress.RedrawInterval = oldDefault, oldInterval
+	})
+	progress.Default = progress.NewTerminalReporter(&out, func() int { return 200 })
+	progress.RedrawInterval = 0
+
+	merger := func(chunks [][]byte) ([]byte, error) {
+		return chunks[0], nil
+	}
+	if _, err := MaybeDownload(context.Background(), t.TempDir(), server.URL+"/releases", "releases.json", "releases", "", merger); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if got, want := out.String(), "\rFetching releases: 2 pages"; !strings.Contains(got, want) {
+		t.Errorf("Expected output to contain %q, but got %q", want, got)
+	}
+}
+
+func TestReadCachedRemoteFileWithinTTL(t *testing.T) {
+	cs := &conditionalServer{body: "abc", etag: `"v1"`}
+	server := httptest.NewServer(cs)
+	defer server.Close()
+	setUpCache(t, time.Hour)
+
+	home := t.TempDir()
+	for i := 0; i < 3; i++ {
+		if _, err := ReadCachedRemoteFile(context.Background(), home, server.URL, "file", ListingTTL); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+	}
+	if cs.requests != 1 {
+		t.Errorf("Expected a single request, but got %d", cs.requests)
+	}
+}
+
+func TestReadCachedRemoteFileChanged(t *testing.T) {
+	cs := &conditionalServer{body: "old", etag: `"v1"`}
+	server := httptest.NewServer(cs)
+	defer server.Close()
+	setUpCache(t, 0)
+
+	home := t.TempDir()
+	if _, err := ReadCachedRemoteFile(context.Background(), home, server.URL, "file", 0); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	cs.body, cs.etag = "new", `"v2"`
+	got, err := ReadCachedRemoteFile(context.Background(), home, server.URL, "file", 0)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if string(got) != "new" {
+		t.Errorf("Expected changed content %q, but got %q", "new", got)
+	}
+
+	validators := readValidators(filepath.Join(home, "file.validators"))
+	if validators == nil || validators.ETag != `"v2"` {
+		t.Errorf("Expected new ETag to be stored, but got %+v", validators)
+	}
+	cached, err := os.ReadFile(filepath.Join(home, "file"))
+	if err != nil || string(cached) != "new" {
+		t.Errorf("Expected cache to contain %q, but got %q (%v)", "new", cached, err)
+	}
+}
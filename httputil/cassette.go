@@ -0,0 +1,185 @@
+package httputil
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"sync"
+	"unicode/utf8"
+)
+
+// Cassette contains HTTP interactions that were recorded by a Recorder, and that can be replayed by a FakeTransport.
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Interaction is a single recorded request together with its response.
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+// RecordedRequest describes a recorded request. During replay, the method, URL and headers have to match exactly.
+type RecordedRequest struct {
+	Method  string            `json:"method"`
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// RecordedResponse describes a recorded response.
+// Bodies that are not valid UTF-8 (e.g. binaries) are stored in BodyBase64 instead of Body.
+type RecordedResponse struct {
+	Status     int               `json:"status"`
+	Headers    map[string]string `json:"headers,omitempty"`
+	Body       string            `json:"body,omitempty"`
+	BodyBase64 string            `json:"body_base64,omitempty"`
+}
+
+// LoadCassette reads a cassette from the given JSON file.
+func LoadCassette(path string) (*Cassette, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read cassette: %v", err)
+	}
+	var c Cassette
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("could not parse cassette %s: %v", path, err)
+	}
+	return &c, nil
+}
+
+// Save writes the cassette to the given JSON file.
+func (c *Cassette) Save(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not serialize cassette: %v", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("could not write cassette: %v", err)
+	}
+	return nil
+}
+
+// AddCassette adds all interactions of the cassette to the transport, so that they are replayed in the recorded order.
+// Each interaction is used at most once.
+func (ft *FakeTransport) AddCassette(c *Cassette) error {
+	for _, i := range c.Interactions {
+		body := i.Response.Body
+		if i.Response.BodyBase64 != "" {
+			decoded, err := base64.StdEncoding.DecodeString(i.Response.BodyBase64)
+			if err != nil {
+				return fmt.Errorf("invalid body of response to %s: %v", i.Request.URL, err)
+			}
+			body = string(decoded)
+		}
+		matcher := RequestMatcher{
+			Method:     i.Request.Method,
+			URLPattern: regexp.QuoteMeta(i.Request.URL),
+			Headers:    i.Request.Headers,
+		}
+		ft.AddMatchingResponse(matcher, i.Response.Status, body, i.Response.Headers)
+	}
+	return nil
+}
+
+var (
+	// DefaultRecordedRequestHeaders contains the request headers that a Recorder stores by default.
+	// Credentials such as "Authorization" are deliberately absent.
+	DefaultRecordedRequestHeaders = []string{"Accept", "Range", "If-None-Match", "If-Modified-Since"}
+
+	ignoredResponseHeaders = []string{"Date", "Set-Cookie"}
+)
+
+// Recorder is an http.RoundTripper that forwards all requests to another RoundTripper and records the interactions.
+type Recorder struct {
+	// Transport sends the actual requests.
+	Transport http.RoundTripper
+	// RequestHeaders lists the request headers that are recorded, and thus have to match during replay.
+	RequestHeaders []string
+
+	mu       sync.Mutex
+	cassette Cassette
+}
+
+// NewRecorder returns a Recorder that sends requests via the given transport.
+func NewRecorder(transport http.RoundTripper) *Recorder {
+	return &Recorder{
+		Transport:      transport,
+		RequestHeaders: DefaultRecordedRequestHeaders,
+	}
+}
+
+// RoundTrip sends the request and records it together with the response.
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	res, err := r.Transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("could not record response from %s: %v", req.URL, err)
+	}
+	res.Body = io.NopCloser(bytes.NewReader(body))
+
+	interaction := Interaction{
+		Request: RecordedRequest{
+			Method:  req.Method,
+			URL:     req.URL.String(),
+			Headers: selectHeaders(req.Header, r.RequestHeaders),
+		},
+		Response: RecordedResponse{
+			Status:  res.StatusCode,
+			Headers: make(map[string]string),
+		},
+	}
+	for k := range res.Header {
+		if !containsHeader(ignoredResponseHeaders, k) {
+			interaction.Response.Headers[k] = res.Header.Get(k)
+		}
+	}
+	if utf8.Valid(body) {
+		interaction.Response.Body = string(body)
+	} else {
+		interaction.Response.BodyBase64 = base64.StdEncoding.EncodeToString(body)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cassette.Interactions = append(r.cassette.Interactions, interaction)
+	return res, nil
+}
+
+// Cassette returns a copy of all interactions that have been recorded so far.
+func (r *Recorder) Cassette() *Cassette {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return &Cassette{Interactions: append([]Interaction(nil), r.cassette.Interactions...)}
+}
+
+func selectHeaders(headers http.Header, names []string) map[string]string {
+	var result map[string]string
+	for _, name := range names {
+		if value := headers.Get(name); value != "" {
+			if result == nil {
+				result = make(map[string]string)
+			}
+			result[http.CanonicalHeaderKey(name)] = value
+		}
+	}
+	return result
+}
+
+func containsHeader(names []string, name string) bool {
+	for _, n := range names {
+		if http.CanonicalHeaderKey(n) == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,199 @@
+package httputil
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bazelbuild/bazelisk/config"
+)
+
+func newPaginatedServer(t *testing.T, binary []byte) *httptest.Server {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/releases":
+			if r.URL.Query().Get("page") != "2" {
+				w.Header().Set("Link", fmt.Sprintf(`<%s/releases?page=2>; rel="next"`, server.URL))
+				w.Write([]byte(`["a"]`))
+			} else {
+				w.Write([]byte(`["b"]`))
+			}
+		case "/bazel":
+			w.Write(binary)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	return server
+}
+
+func fetchReleasesAndBinary(t *testing.T, baseURL string) (string, []byte) {
+	merger := func(chunks [][]byte) ([]byte, error) {
+		return []byte(fmt.Sprintf("%s", chunks)), nil
+	}
+	releases, err := MaybeDownload(context.Background(), t.TempDir(), baseURL+"/releases", "releases.json", "releases", "", merger)
+	if err != nil {
+		t.Fatalf("Could not download releases: %v", err)
+	}
+	path, err := DownloadBinary(context.Background(), baseURL+"/bazel", t.TempDir(), "bazel", config.Null())
+	if err != nil {
+		t.Fatalf("Could not download binary: %v", err)
+	}
+	binary, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Could not read binary: %v", err)
+	}
+	return string(releases), binary
+}
+
+func TestRecordAndReplayCassette(t *testing.T) {
+	binary := []byte{0x7f, 'E', 'L', 'F', 0xff, 0xfe, 0x00}
+	server := newPaginatedServer(t, binary)
+	setUpRealTransport(t)
+
+	recorder := NewRecorder(http.DefaultTransport)
+	DefaultTransport = recorder
+	wantReleases, _ := fetchReleasesAndBinary(t, server.URL)
+	server.Close()
+
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	if err := recorder.Cassette().Save(path); err != nil {
+		t.Fatalf("Could not save cassette: %v", err)
+	}
+	cassette, err := LoadCassette(path)
+	if err != nil {
+		t.Fatalf("Could not load cassette: %v", err)
+	}
+	if got := len(cassette.Interactions); got != 3 {
+		t.Fatalf("Expected 3 recorded interactions, but got %d", got)
+	}
+
+	transport := NewFakeTransport()
+	if err := transport.AddCassette(cassette); err != nil {
+		t.Fatalf("Could not add cassette: %v", err)
+	}
+	DefaultTransport = transport
+	gotReleases, gotBinary := fetchReleasesAndBinary(t, server.URL)
+	if gotReleases != wantReleases {
+		t.Errorf("Expected replayed releases %q, but got %q", wantReleases, gotReleases)
+	}
+	if string(gotBinary) != string(binary) {
+		t.Errorf("Expected replayed binary %v, but got %v", binary, gotBinary)
+	}
+	transport.AssertRequested(t, server.URL+"/releases", server.URL+"/releases?page=2", server.URL+"/bazel")
+}
+
+func TestRecorderOmitsCredentials(t *testing.T) {
+	server := newPaginatedServer(t, nil)
+	defer server.Close()
+	setUpRealTransport(t)
+
+	recorder := NewRecorder(http.DefaultTransport)
+	DefaultTransport = recorder
+	if _, _, err := ReadRemoteFileWithHeaders(context.Background(), server.URL+"/releases?page=2", map[string]string{"Authorization": "token secret", "Accept": "application/json"}); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	headers := recorder.Cassette().Interactions[0].Request.Headers
+	if _, ok := headers["Authorization"]; ok {
+		t.Errorf("Expected Authorization header not to be recorded")
+	}
+	if headers["Accept"] != "application/json" {
+		t.Errorf("Expected Accept header to be recorded, but got %v", headers)
+	}
+}
+
+func TestMatchingResponses(t *testing.T) {
+	transport := NewFakeTransport()
+	transport.AddMatchingResponse(RequestMatcher{Method: "HEAD", URLPattern: `https://example\.com/.*`}, 200, "", map[string]string{"Accept-Ranges": "bytes"})
+	transport.AddMatchingResponse(RequestMatcher{URLPattern: `https://example\.com/.*`, Headers: map[string]string{"Range": "bytes=0-1"}}, 206, "ab", nil)
+	transport.AddMatchingResponse(RequestMatcher{URLPattern: `https://example\.com/.*`}, 200, "abcd", nil)
+	transport.AddResponse("https://example.com/exact", 200, "exact", nil)
+
+	send := func(method, url string, headers map[string]string) (int, string) {
+		req, err := http.NewRequest(method, url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		res, err := transport.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		defer res.Body.Close()
+		body, err := io.ReadAll(res.Body)
+		if err != nil {
+			t.Fatalf("Could not read body: %v", err)
+		}
+		return res.StatusCode, string(body)
+	}
+
+	tests := []struct {
+		method     string
+		url        string
+		headers    map[string]string
+		wantStatus int
+		wantBody   string
+	}{
+		{method: "GET", url: "https://example.com/exact", wantStatus: 200, wantBody: "exact"},
+		{method: "HEAD", url: "https://example.com/bazel", wantStatus: 200},
+		{method: "GET", url: "https://example.com/bazel", headers: map[string]string{"Range": "bytes=0-1"}, wantStatus: 206, wantBody: "ab"},
+		{method: "GET", url: "https://example.com/bazel", wantStatus: 200, wantBody: "abcd"},
+		// All matching responses have been used up.
+		{method: "GET", url: "https://example.com/bazel", wantStatus: 404},
+		{method: "GET", url: "https://other.com/bazel", wantStatus: 404},
+	}
+	for _, tc := range tests {
+		status, body := send(tc.method, tc.url, tc.headers)
+		if status != tc.wantStatus || body != tc.wantBody {
+			t.Errorf("%s %s: expected %d %q, but got %d %q", tc.method, tc.url, tc.wantStatus, tc.wantBody, status, body)
+		}
+	}
+	transport.AssertRequestCount(t, `https://example\.com/.*`, 5)
+}
+
+type recordingT struct {
+	errors []string
+}
+
+func (rt *recordingT) Helper() {}
+
+func (rt *recordingT) Errorf(format string, args ...interface{}) {
+	rt.errors = append(rt.errors, fmt.Sprintf(format, args...))
+}
+
+func TestTransportAssertions(t *testing.T) {
+	transport := NewFakeTransport()
+	transport.RequestedURLs = []string{"https://a", "https://b", "https://c"}
+
+	tests := []struct {
+		name       string
+		assert     func(TestingT)
+		wantErrors int
+	}{
+		{"in order", func(rt TestingT) { transport.AssertRequested(rt, "https://a", "https://c") }, 0},
+		{"wrong order", func(rt TestingT) { transport.AssertRequested(rt, "https://c", "https://a") }, 1},
+		{"missing", func(rt TestingT) { transport.AssertRequested(rt, "https://d") }, 1},
+		{"not requested", func(rt TestingT) { transport.AssertNotRequested(rt, "https://d") }, 0},
+		{"unexpectedly requested", func(rt TestingT) { transport.AssertNotRequested(rt, "https://b", "https://d") }, 1},
+		{"count", func(rt TestingT) { transport.AssertRequestCount(rt, `https://[ab]`, 2) }, 0},
+		{"wrong count", func(rt TestingT) { transport.AssertRequestCount(rt, `https://.*`, 2) }, 1},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rt := &recordingT{}
+			tc.assert(rt)
+			if len(rt.errors) != tc.wantErrors {
+				t.Errorf("Expected %d errors, but got %v", tc.wantErrors, rt.errors)
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package httputil
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/bazelbuild/bazelisk/config"
+	"github.com/bazelbuild/bazelisk/httputil/progress"
+)
+
+const (
+	// DownloadChunksEnv is the name of the config value that sets the number of concurrent ranged requests
+	// that are used to download a binary. Values below 2 disable parallel downloads.
+	DownloadChunksEnv = "BAZELISK_DOWNLOAD_CHUNKS"
+)
+
+var (
+	// MinChunkSize is the minimum number of bytes per chunk in parallel downloads.
+	// Files smaller than two chunks are always downloaded with a single request.
+	MinChunkSize int64 = 4 * 1024 * 1024
+)
+
+func downloadChunks(config config.Config) (int, error) {
+	value := config.Get(DownloadChunksEnv)
+	if value == "" {
+		return 0, nil
+	}
+	chunks, err := strconv.Atoi(value)
+	if err != nil || chunks < 0 {
+		return 0, fmt.Errorf("invalid value %q for %s: must be a non-negative integer", value, DownloadChunksEnv)
+	}
+	return chunks, nil
+}
+
+// downloadInChunks downloads the given URL into the file using up to the given number of concurrent ranged requests.
+// It returns false without touching the file if the server does not support ranged requests,
+// or if the file is too small to be worth splitting. In that case the caller should fall back to a single request.
+func downloadInChunks(ctx context.Context, originURL string, headers map[string]string, file *os.File, chunks int, limiter *bandwidthLimiter, reporter progress.Reporter, config config.Config) (bool, error) {
+	size, ok := probeRangeSupport(ctx, originURL, headers, config)
+	if !ok || size < 2*MinChunkSize {
+		return false, nil
+	}
+	if maxChunks := int(size / MinChunkSize); chunks > maxChunks {
+		chunks = maxChunks
+	}
+
+	if err := file.Truncate(size); err != nil {
+		return true, fmt.Errorf("could not allocate %d bytes in %s: %v", size, file.Name(), err)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	client := newClient(headers)
+	// All chunks share a single progress bar.
+	reporter.Start("Downloading", size, progress.Bytes)
+	defer reporter.Finish()
+	prog := progress.Writer(io.Discard, reporter)
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	chunkSize := size / int64(chunks)
+	for i := 0; i < chunks; i++ {
+		start := int64(i) * chunkSize
+		end := start + chunkSize - 1
+		if i == chunks-1 {
+			end = size - 1
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := downloadChunk(ctx, client, originURL, headers, start, end, file, prog, limiter); err != nil {
+				mu.Lock()
+				defer mu.Unlock()
+				// Only report the first failure, since it cancels all other chunks.
+				if firstErr == nil {
+					firstErr = err
+					cancel()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return true, firstErr
+}
+
+// probeRangeSupport sends a HEAD request and returns the size of the file if the server accepts byte ranges.
+func probeRangeSupport(ctx context.Context, originURL string, headers map[string]string, config config.Config) (int64, bool) {
+	req, err := newDownloadRequest(originURL, headers)
+	if err != nil {
+		return 0, false
+	}
+	req.Method = "HEAD"
+	res, err := doWithTimeouts(ctx, newClient(headers), req)
+	if err != nil {
+		logAtVerbosity(config, 1, "Could not check whether %s supports ranged requests: %v", originURL, err)
+		return 0, false
+	}
+	res.Body.Close()
+	if res.StatusCode != 200 || res.ContentLength <= 0 || !strings.EqualFold(res.Header.Get("Accept-Ranges"), "bytes") {
+		logAtVerbosity(config, 1, "%s does not support ranged requests, downloading it in a single request", originURL)
+		return 0, false
+	}
+	return res.ContentLength, true
+}
+
+// downloadChunk downloads the inclusive byte range [start, end] into the same range of the file.
+// Retries resume after the last byte that was received.
+func downloadChunk(ctx context.Context, client *http.Client, originURL string, headers map[string]string, start, end int64, file *os.File, prog io.Writer, limiter *bandwidthLimiter) error {
+	req, err := newDownloadRequest(originURL, headers)
+	if err != nil {
+		return err
+	}
+	offset := start
+	description := fmt.Sprintf("bytes %d-%d of %s", start, end, originURL)
+	return retryDownload(ctx, description, func(ctx context.Context) (*http.Response, bool, error) {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, end))
+		res, err := doWithTimeouts(ctx, client, req)
+		if err != nil {
+			return nil, true, err
+		}
+		defer res.Body.Close()
+
+		if res.StatusCode != http.StatusPartialContent {
+			if res.StatusCode == 200 {
+				return res, false, fmt.Errorf("server ignored the requested range")
+			}
+			return res, shouldRetry(res, nil), fmt.Errorf("HTTP %d", res.StatusCode)
+		}
+
+		w := io.MultiWriter(io.NewOffsetWriter(file, offset), prog)
+		written, err := io.Copy(w, io.LimitReader(limiter.reader(ctx, res.Body), end-offset+1))
+		offset += written
+		if err != nil {
+			return res, true, fmt.Errorf("could not read body after %d bytes: %v", written, err)
+		}
+		if offset <= end {
+			return res, true, fmt.Errorf("body is truncated: received %d of %d bytes", offset-start, end-start+1)
+		}
+		return res, false, nil
+	})
+}
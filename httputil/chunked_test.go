@@ -0,0 +1,151 @@
+package httputil
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bazelbuild/bazelisk/config"
+)
+
+type rangeServer struct {
+	content []byte
+
+	mu     sync.Mutex
+	ranges []string
+	// failFirst makes the first ranged request for the given offset return a truncated body.
+	failFirst string
+}
+
+func (rs *rangeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rng := r.Header.Get("Range")
+	if r.Method == "GET" && rng != "" {
+		rs.mu.Lock()
+		rs.ranges = append(rs.ranges, rng)
+		fail := rng == rs.failFirst
+		if fail {
+			rs.failFirst = ""
+		}
+		rs.mu.Unlock()
+		if fail {
+			w.Header().Set("Content-Length", "10")
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write(rs.content[:3])
+			return
+		}
+	}
+	http.ServeContent(w, r, "bazel", time.Time{}, bytes.NewReader(rs.content))
+}
+
+func setUpChunkedDownload(t *testing.T) {
+	setUpRealTransport(t)
+	oldMinChunkSize := MinChunkSize
+	t.Cleanup(func() {
+		MinChunkSize = oldMinChunkSize
+	})
+	MinChunkSize = 10
+}
+
+func downloadToString(t *testing.T, url string, cfg config.Config) string {
+	path, err := DownloadBinary(context.Background(), url, t.TempDir(), "bazel", cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Could not read downloaded file: %v", err)
+	}
+	return string(content)
+}
+
+func TestChunkedDownload(t *testing.T) {
+	content := strings.Repeat("0123456789", 10) + "xyz"
+	rs := &rangeServer{content: []byte(content)}
+	server := httptest.NewServer(rs)
+	defer server.Close()
+	setUpChunkedDownload(t)
+
+	got := downloadToString(t, server.URL, config.Static(map[string]string{DownloadChunksEnv: "4"}))
+	if got != content {
+		t.Errorf("Expected content %q, but got %q", content, got)
+	}
+	if len(rs.ranges) != 4 {
+		t.Errorf("Expected 4 ranged requests, but got %v", rs.ranges)
+	}
+}
+
+func TestChunkedDownloadLimitsNumberOfChunks(t *testing.T) {
+	content := strings.Repeat("a", 25)
+	rs := &rangeServer{content: []byte(content)}
+	server := httptest.NewServer(rs)
+	defer server.Close()
+	setUpChunkedDownload(t)
+
+	got := downloadToString(t, server.URL, config.Static(map[string]string{DownloadChunksEnv: "8"}))
+	if got != content {
+		t.Errorf("Expected content %q, but got %q", content, got)
+	}
+	if len(rs.ranges) != 2 {
+		t.Errorf("Expected 2 ranged requests for a file of two chunks, but got %v", rs.ranges)
+	}
+}
+
+func TestChunkedDownloadResumesFailedChunk(t *testing.T) {
+	content := strings.Repeat("0123456789", 4)
+	rs := &rangeServer{content: []byte(content), failFirst: "bytes=20-39"}
+	server := httptest.NewServer(rs)
+	defer server.Close()
+	setUpChunkedDownload(t)
+	MaxRetries = 1
+	RetryClock = newFakeClock()
+
+	got := downloadToString(t, server.URL, config.Static(map[string]string{DownloadChunksEnv: "2"}))
+	if got != content {
+		t.Errorf("Expected content %q, but got %q", content, got)
+	}
+	resumed := false
+	for _, r := range rs.ranges {
+		if r == "bytes=23-39" {
+			resumed = true
+		}
+	}
+	if !resumed {
+		t.Errorf("Expected retry to resume after the received bytes, but got requests %v", rs.ranges)
+	}
+}
+
+func TestChunkedDownloadFallsBackWithoutRangeSupport(t *testing.T) {
+	content := strings.Repeat("b", 100)
+	var methods []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		methods = append(methods, r.Method)
+		if r.Header.Get("Range") != "" {
+			t.Errorf("Unexpected ranged request %q", r.Header.Get("Range"))
+		}
+		w.Write([]byte(content))
+	}))
+	defer server.Close()
+	setUpChunkedDownload(t)
+
+	got := downloadToString(t, server.URL, config.Static(map[string]string{DownloadChunksEnv: "4"}))
+	if got != content {
+		t.Errorf("Expected content %q, but got %q", content, got)
+	}
+	if strings.Join(methods, ",") != "HEAD,GET" {
+		t.Errorf("Expected a HEAD request followed by a single GET request, but got %v", methods)
+	}
+}
+
+func TestInvalidDownloadChunks(t *testing.T) {
+	setUp()
+	_, err := DownloadBinary(context.Background(), "http://foo/bazel", t.TempDir(), "bazel", config.Static(map[string]string{DownloadChunksEnv: "many"}))
+	if err == nil || !strings.Contains(err.Error(), DownloadChunksEnv) {
+		t.Fatalf("Expected error about %s, but got %v", DownloadChunksEnv, err)
+	}
+}
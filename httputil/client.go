@@ -0,0 +1,311 @@
+package httputil
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	homedir "github.com/mitchellh/go-homedir"
+
+	"github.com/bazelbuild/bazelisk/config"
+)
+
+const (
+	// CABundleEnv is the name of the config value that points to a PEM file with additional trusted CA certificates.
+	CABundleEnv = "BAZELISK_CA_BUNDLE"
+	// ClientCertEnv is the name of the config value that points to a PEM file with a TLS client certificate.
+	ClientCertEnv = "BAZELISK_CLIENT_CERT"
+	// ClientKeyEnv is the name of the config value that points to a PEM file with the private key of the TLS client certificate.
+	ClientKeyEnv = "BAZELISK_CLIENT_KEY"
+	// ProxyEnv is the name of the config value that specifies the proxy for all requests, regardless of HTTP_PROXY and HTTPS_PROXY.
+	// The special value "direct" disables proxies.
+	ProxyEnv = "BAZELISK_PROXY"
+	// NoProxyEnv is the name of the config value that lists comma-separated hosts or domains that bypass the proxy from ProxyEnv.
+	NoProxyEnv = "BAZELISK_NO_PROXY"
+	// ConnectTimeoutEnv is the name of the config value that overrides ConnectTimeout, e.g. "10s".
+	ConnectTimeoutEnv = "BAZELISK_CONNECT_TIMEOUT"
+	// HeaderTimeoutEnv is the name of the config value that overrides ResponseHeaderTimeout, e.g. "30s".
+	HeaderTimeoutEnv = "BAZELISK_HEADER_TIMEOUT"
+	// IdleTimeoutEnv is the name of the config value that overrides IdleBodyTimeout, e.g. "1m".
+	IdleTimeoutEnv = "BAZELISK_IDLE_TIMEOUT"
+)
+
+var (
+	// ConnectTimeout limits how long establishing a connection may take. It only applies to transports created by NewTransport.
+	ConnectTimeout = 30 * time.Second
+	// ResponseHeaderTimeout limits how long a single request attempt may wait for the response headers.
+	ResponseHeaderTimeout = 30 * time.Second
+	// IdleBodyTimeout limits how long reading the response body may stall before the request is aborted.
+	IdleBodyTimeout = time.Minute
+
+	// configuredTransport is the transport that the last call of ConfigureTransport installed as DefaultTransport,
+	// replacing transportBeforeConfig.
+	configuredTransport   *http.Transport
+	transportBeforeConfig http.RoundTripper
+)
+
+// ConfigureTransport applies the timeouts and the listing TTL from the given config, and replaces DefaultTransport with a transport
+// that uses the TLS, proxy and connect timeout settings from the config. That transport is based on http.DefaultTransport,
+// not on a custom DefaultTransport.
+// It keeps DefaultTransport unchanged if none of these settings are present. Settings from a previous call are reverted
+// first, so that a process can configure the transport for one workspace after another.
+func ConfigureTransport(config config.Config) error {
+	if configuredTransport != nil && DefaultTransport == http.RoundTripper(configuredTransport) {
+		DefaultTransport = transportBeforeConfig
+	}
+	configuredTransport, transportBeforeConfig = nil, nil
+
+	if err := configureDurations(config); err != nil {
+		return err
+	}
+	logVerbosity = Verbosity(config)
+
+	configured := false
+	for _, name := range []string{CABundleEnv, ClientCertEnv, ClientKeyEnv, ProxyEnv, NoProxyEnv, ConnectTimeoutEnv} {
+		if config.Get(name) != "" {
+			configured = true
+			break
+		}
+	}
+	if !configured {
+		return nil
+	}
+
+	transport, err := NewTransport(config)
+	if err != nil {
+		return err
+	}
+	configuredTransport, transportBeforeConfig = transport, DefaultTransport
+	DefaultTransport = transport
+	return nil
+}
+
+// NewTransport returns a copy of http.DefaultTransport with the TLS and proxy settings from the given config.
+func NewTransport(config config.Config) (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{
+		Timeout:   ConnectTimeout,
+		KeepAlive: 30 * time.Second,
+	}).DialContext
+	transport.TLSHandshakeTimeout = ConnectTimeout
+
+	tlsConfig, err := newTLSConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	transport.TLSClientConfig = tlsConfig
+
+	proxy, err := newProxyFunc(config)
+	if err != nil {
+		return nil, err
+	}
+	transport.Proxy = proxy
+	return transport, nil
+}
+
+// overriddenDuration remembers the value that configureDurations replaced.
+type overriddenDuration struct {
+	previous, configured time.Duration
+}
+
+// overriddenDurations contains the durations that the last call of configureDurations changed.
+var overriddenDurations = make(map[*time.Duration]overriddenDuration)
+
+func configureDurations(config config.Config) error {
+	// Revert the previous config, unless the value has been changed elsewhere in the meantime.
+	for duration, overridden := range overriddenDurations {
+		if *duration == overridden.configured {
+			*duration = overridden.previous
+		}
+	}
+	clear(overriddenDurations)
+
+	for name, duration := range map[string]*time.Duration{
+		ConnectTimeoutEnv: &ConnectTimeout,
+		HeaderTimeoutEnv:  &ResponseHeaderTimeout,
+		IdleTimeoutEnv:    &IdleBodyTimeout,
+		ListingTTLEnv:     &ListingTTL,
+		RateLimitWaitEnv:  &MaxRateLimitWait,
+	} {
+		value := config.Get(name)
+		if value == "" {
+			continue
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil || d < 0 {
+			return fmt.Errorf("invalid duration %q in %s", value, name)
+		}
+		overriddenDurations[duration] = overriddenDuration{previous: *duration, configured: d}
+		*duration = d
+	}
+	return nil
+}
+
+func newTLSConfig(config config.Config) (*tls.Config, error) {
+	tlsConfig := &tls.Config{}
+
+	if bundle := config.Get(CABundleEnv); bundle != "" {
+		path, err := homedir.Expand(bundle)
+		if err != nil {
+			return nil, fmt.Errorf("could not expand home directory in %s: %v", CABundleEnv, err)
+		}
+		pem, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("could not read CA bundle %s: %v", path, err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("CA bundle %s does not contain any PEM certificates", path)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	certFile, keyFile := config.Get(ClientCertEnv), config.Get(ClientKeyEnv)
+	if certFile == "" && keyFile == "" {
+		return tlsConfig, nil
+	} else if certFile == "" || keyFile == "" {
+		return nil, fmt.Errorf("%s and %s must be set together", ClientCertEnv, ClientKeyEnv)
+	}
+	certPath, err := homedir.Expand(certFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not expand home directory in %s: %v", ClientCertEnv, err)
+	}
+	keyPath, err := homedir.Expand(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not expand home directory in %s: %v", ClientKeyEnv, err)
+	}
+	cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("could not load client certificate %s: %v", certPath, err)
+	}
+	tlsConfig.Certificates = []tls.Certificate{cert}
+	return tlsConfig, nil
+}
+
+// newProxyFunc returns the proxy function for the transport. Without ProxyEnv, it falls back to the proxy environment variables.
+func newProxyFunc(config config.Config) (func(*http.Request) (*url.URL, error), error) {
+	value := config.Get(ProxyEnv)
+	if value == "" {
+		return http.ProxyFromEnvironment, nil
+	} else if value == "direct" {
+		return nil, nil
+	}
+
+	proxyURL, err := url.Parse(value)
+	if err != nil || proxyURL.Host == "" {
+		return nil, fmt.Errorf("invalid proxy URL %q in %s", value, ProxyEnv)
+	}
+
+	var noProxy []string
+	for _, entry := range strings.Split(config.Get(NoProxyEnv), ",") {
+		if entry = strings.TrimPrefix(strings.TrimSpace(entry), "."); entry != "" {
+			noProxy = append(noProxy, strings.ToLower(entry))
+		}
+	}
+
+	return func(req *http.Request) (*url.URL, error) {
+		host := strings.ToLower(req.URL.Hostname())
+		for _, entry := range noProxy {
+			if entry == "*" || host == entry || strings.HasSuffix(host, "."+entry) {
+				return nil, nil
+			}
+		}
+		return proxyURL, nil
+	}, nil
+}
+
+// doWithTimeouts sends the request and aborts it if the response headers do not arrive within ResponseHeaderTimeout,
+// or if the response body does not yield any data for IdleBodyTimeout. A timeout of zero disables the respective check.
+func doWithTimeouts(ctx context.Context, client *http.Client, req *http.Request) (*http.Response, error) {
+	attemptCtx, cancel := context.WithCancel(ctx)
+	headerTimer := newTimeoutTimer(ResponseHeaderTimeout, cancel)
+	res, err := client.Do(req.WithContext(attemptCtx))
+	if headerTimer.Stop() {
+		if res != nil {
+			res.Body.Close()
+		}
+		cancel()
+		return nil, fmt.Errorf("no response headers received from %s within %v", req.URL, ResponseHeaderTimeout)
+	}
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	res.Body = &idleTimeoutBody{
+		body:    res.Body,
+		url:     req.URL.String(),
+		timer:   newTimeoutTimer(IdleBodyTimeout, cancel),
+		timeout: IdleBodyTimeout,
+		cancel:  cancel,
+	}
+	return res, nil
+}
+
+// timeoutTimer calls a function once a timeout expires, and remembers whether that happened.
+type timeoutTimer struct {
+	timer   *time.Timer
+	expired atomic.Bool
+}
+
+func newTimeoutTimer(timeout time.Duration, onExpiry func()) *timeoutTimer {
+	t := &timeoutTimer{}
+	if timeout > 0 {
+		t.timer = time.AfterFunc(timeout, func() {
+			t.expired.Store(true)
+			onExpiry()
+		})
+	}
+	return t
+}
+
+// Reset restarts the timeout, unless it already expired.
+func (t *timeoutTimer) Reset(timeout time.Duration) {
+	if t.timer != nil && !t.expired.Load() {
+		t.timer.Reset(timeout)
+	}
+}
+
+// Stop disables the timer and returns whether the timeout had already expired.
+func (t *timeoutTimer) Stop() bool {
+	if t.timer != nil {
+		t.timer.Stop()
+	}
+	return t.expired.Load()
+}
+
+// idleTimeoutBody wraps a response body and cancels the request if a single read takes longer than the timeout.
+type idleTimeoutBody struct {
+	body    io.ReadCloser
+	url     string
+	timer   *timeoutTimer
+	timeout time.Duration
+	cancel  context.CancelFunc
+}
+
+func (b *idleTimeoutBody) Read(p []byte) (int, error) {
+	b.timer.Reset(b.timeout)
+	n, err := b.body.Read(p)
+	if err != nil && b.timer.expired.Load() {
+		return n, fmt.Errorf("no data received from %s for %v: %v", b.url, b.timeout, err)
+	}
+	return n, err
+}
+
+func (b *idleTimeoutBody) Close() error {
+	b.timer.Stop()
+	defer b.cancel()
+	return b.body.Close()
+}
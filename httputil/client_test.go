@@ -0,0 +1,291 @@
+package httputil
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bazelbuild/bazelisk/config"
+)
+
+func writeCABundle(t *testing.T, server *httptest.Server) string {
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	block := &pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}
+	if err := os.WriteFile(path, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatalf("Could not write CA bundle: %v", err)
+	}
+	return path
+}
+
+func TestConfigureTransportWithCABundle(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "the_body")
+	}))
+	defer server.Close()
+
+	setUp()
+	defer func(retries int) { MaxRetries = retries }(MaxRetries)
+	MaxRetries = 0
+	if err := ConfigureTransport(config.Static(map[string]string{ProxyEnv: "direct"})); err != nil {
+		t.Fatalf("ConfigureTransport(): unexpected error %v", err)
+	}
+	if _, _, err := ReadRemoteFile(context.Background(), server.URL, ""); err == nil {
+		t.Fatal("Expected request to fail without the CA bundle")
+	}
+
+	cfg := config.Static(map[string]string{CABundleEnv: writeCABundle(t, server), ProxyEnv: "direct"})
+	if err := ConfigureTransport(cfg); err != nil {
+		t.Fatalf("ConfigureTransport(): unexpected error %v", err)
+	}
+	body, _, err := ReadRemoteFile(context.Background(), server.URL, "")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if string(body) != "the_body" {
+		t.Fatalf("Expected body %q, but got %q", "the_body", body)
+	}
+}
+
+func TestConfigureTransportRevertsPreviousConfig(t *testing.T) {
+	original, _ := setUp()
+	oldHeaderTimeout, oldTTL := ResponseHeaderTimeout, ListingTTL
+	t.Cleanup(func() { ResponseHeaderTimeout, ListingTTL = oldHeaderTimeout, oldTTL })
+
+	cfg := config.Static(map[string]string{ProxyEnv: "http://proxy.example.com:8080", HeaderTimeoutEnv: "1s", ListingTTLEnv: "2h"})
+	if err := ConfigureTransport(cfg); err != nil {
+		t.Fatalf("ConfigureTransport(): unexpected error %v", err)
+	}
+	if DefaultTransport == http.RoundTripper(original) || ResponseHeaderTimeout != time.Second || ListingTTL != 2*time.Hour {
+		t.Fatalf("Expected the config to be applied")
+	}
+
+	if err := ConfigureTransport(config.Null()); err != nil {
+		t.Fatalf("ConfigureTransport(): unexpected error %v", err)
+	}
+	if DefaultTransport != http.RoundTripper(original) {
+		t.Errorf("Expected the previous DefaultTransport to be restored")
+	}
+	if ResponseHeaderTimeout != oldHeaderTimeout || ListingTTL != oldTTL {
+		t.Errorf("Expected the previous durations %v and %v, but got %v and %v", oldHeaderTimeout, oldTTL, ResponseHeaderTimeout, ListingTTL)
+	}
+}
+
+// writeClientCertificate creates a self-signed client certificate and returns the paths of the certificate and its key.
+func writeClientCertificate(t *testing.T) (*x509.Certificate, string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Could not generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "bazelisk-test-client"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Could not create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("Could not parse certificate: %v", err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Could not marshal key: %v", err)
+	}
+
+	dir := t.TempDir()
+	certPath, keyPath := filepath.Join(dir, "client.pem"), filepath.Join(dir, "client.key")
+	os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+	return cert, certPath, keyPath
+}
+
+func TestConfigureTransportWithClientCertificate(t *testing.T) {
+	clientCert, certPath, keyPath := writeClientCertificate(t)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.TLS.PeerCertificates[0].Subject.CommonName)
+	}))
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert)
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	server.StartTLS()
+	defer server.Close()
+
+	setUp()
+	cfg := config.Static(map[string]string{
+		CABundleEnv:   writeCABundle(t, server),
+		ClientCertEnv: certPath,
+		ClientKeyEnv:  keyPath,
+		ProxyEnv:      "direct",
+	})
+	if err := ConfigureTransport(cfg); err != nil {
+		t.Fatalf("ConfigureTransport(): unexpected error %v", err)
+	}
+	body, _, err := ReadRemoteFile(context.Background(), server.URL, "")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if string(body) != "bazelisk-test-client" {
+		t.Fatalf("Expected the server to see the client certificate, but got %q", body)
+	}
+}
+
+func TestConfigureTransportKeepsDefaultTransport(t *testing.T) {
+	transport, _ := setUp()
+	if err := ConfigureTransport(config.Null()); err != nil {
+		t.Fatalf("ConfigureTransport(): unexpected error %v", err)
+	}
+	if DefaultTransport != transport {
+		t.Errorf("Expected DefaultTransport to stay unchanged without any settings")
+	}
+}
+
+func TestConfigureTransportInvalidSettings(t *testing.T) {
+	tests := []map[string]string{
+		{CABundleEnv: filepath.Join(t.TempDir(), "missing.pem")},
+		{ClientCertEnv: "cert.pem"},
+		{ProxyEnv: "://invalid"},
+	}
+	for _, values := range tests {
+		if err := ConfigureTransport(config.Static(values)); err == nil {
+			t.Errorf("Expected ConfigureTransport(%v) to fail", values)
+		}
+	}
+}
+
+func TestProxy(t *testing.T) {
+	var proxied []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = append(proxied, r.URL.String())
+		fmt.Fprint(w, "from_proxy")
+	}))
+	defer proxy.Close()
+
+	transport, err := NewTransport(config.Static(map[string]string{
+		ProxyEnv:   proxy.URL,
+		NoProxyEnv: "internal.example.com, .corp.example.com",
+	}))
+	if err != nil {
+		t.Fatalf("NewTransport(): unexpected error %v", err)
+	}
+
+	for url, wantProxy := range map[string]bool{
+		"http://releases.example.com/bazel": true,
+		"http://internal.example.com/bazel": false,
+		"http://mirror.corp.example.com/x":  false,
+	} {
+		req, _ := http.NewRequest("GET", url, nil)
+		got, err := transport.Proxy(req)
+		if err != nil {
+			t.Fatalf("Proxy(%q): unexpected error %v", url, err)
+		}
+		if (got != nil) != wantProxy {
+			t.Errorf("Proxy(%q) = %v, want proxy: %v", url, got, wantProxy)
+		}
+	}
+
+	setUp()
+	DefaultTransport = transport
+	body, _, err := ReadRemoteFile(context.Background(), "http://releases.example.com/bazel", "")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if string(body) != "from_proxy" || len(proxied) != 1 || proxied[0] != "http://releases.example.com/bazel" {
+		t.Errorf("Expected the request to go through the proxy, but got body %q and proxied requests %v", body, proxied)
+	}
+}
+
+func setUpRealTransport(t *testing.T) {
+	setUp()
+	DefaultTransport = http.DefaultTransport
+	oldRetries, oldHeaderTimeout, oldIdleTimeout := MaxRetries, ResponseHeaderTimeout, IdleBodyTimeout
+	t.Cleanup(func() {
+		MaxRetries, ResponseHeaderTimeout, IdleBodyTimeout = oldRetries, oldHeaderTimeout, oldIdleTimeout
+	})
+	MaxRetries = 0
+}
+
+func TestResponseHeaderTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	setUpRealTransport(t)
+	ResponseHeaderTimeout = 50 * time.Millisecond
+	_, _, err := ReadRemoteFile(context.Background(), server.URL, "")
+	if err == nil || !strings.Contains(err.Error(), "no response headers received") {
+		t.Fatalf("Expected header timeout, but got %v", err)
+	}
+}
+
+func TestIdleBodyTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "1000")
+		fmt.Fprint(w, "partial")
+		w.(http.Flusher).Flush()
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	setUpRealTransport(t)
+	IdleBodyTimeout = 50 * time.Millisecond
+	_, _, err := ReadRemoteFile(context.Background(), server.URL, "")
+	if err == nil || !strings.Contains(err.Error(), "no data received") {
+		t.Fatalf("Expected idle body timeout, but got %v", err)
+	}
+}
+
+func TestCancelledContext(t *testing.T) {
+	transport, clock := setUp()
+	url := "http://foo"
+	transport.AddResponse(url, 503, "", nil)
+	transport.AddResponse(url, 200, "the_body", nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, _, err := ReadRemoteFile(ctx, url, "")
+	if err == nil || !strings.Contains(err.Error(), "was cancelled") {
+		t.Fatalf("Expected request to be cancelled, but got %v", err)
+	}
+	if clock.TimesSlept() > 0 {
+		t.Fatalf("Expected no retries after cancellation, but got %d", clock.TimesSlept())
+	}
+}
+
+func TestConfigureTimeouts(t *testing.T) {
+	setUpRealTransport(t)
+	if err := ConfigureTransport(config.Static(map[string]string{HeaderTimeoutEnv: "5s", IdleTimeoutEnv: "2m"})); err != nil {
+		t.Fatalf("ConfigureTransport(): unexpected error %v", err)
+	}
+	if ResponseHeaderTimeout != 5*time.Second || IdleBodyTimeout != 2*time.Minute {
+		t.Errorf("Expected timeouts 5s and 2m, but got %v and %v", ResponseHeaderTimeout, IdleBodyTimeout)
+	}
+	if err := ConfigureTransport(config.Static(map[string]string{IdleTimeoutEnv: "soon"})); err == nil {
+		t.Errorf("Expected ConfigureTransport() to fail for invalid duration")
+	}
+}
@@ -0,0 +1,74 @@
+package httputil
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gofrs/flock"
+
+	"github.com/bazelbuild/bazelisk/config"
+)
+
+const (
+	// DownloadLockDirEnv is the name of the config value that overrides the directory with the lock files of LockDownload.
+	DownloadLockDirEnv = "BAZELISK_DOWNLOAD_LOCK_DIR"
+	// DownloadLockTimeoutEnv is the name of the config value that overrides DownloadLockTimeout, e.g. "5m".
+	DownloadLockTimeoutEnv = "BAZELISK_DOWNLOAD_LOCK_TIMEOUT"
+)
+
+var (
+	// DownloadLockTimeout limits how long Bazelisk waits for another process that downloads the same Bazel binary.
+	// Afterwards it downloads the binary itself.
+	DownloadLockTimeout = 10 * time.Minute
+	// DownloadLockPollInterval specifies how often LockDownload checks whether the lock has become available.
+	DownloadLockPollInterval = 100 * time.Millisecond
+)
+
+// LockDownload acquires a host-wide lock for the given key (e.g. a URL), so that only one process downloads
+// the same file at a time, while the others can wait for the result instead of downloading it in parallel.
+// By default the lock files are stored in the "downloads/locks" directory inside bazeliskHome.
+// It blocks until the lock is available or the context is done, and returns a function that releases the lock.
+func LockDownload(ctx context.Context, bazeliskHome, key string, config config.Config) (func(), error) {
+	dir := config.Get(DownloadLockDirEnv)
+	if dir == "" {
+		dir = filepath.Join(bazeliskHome, "downloads", "locks")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("could not create lock directory %s: %v", dir, err)
+	}
+
+	lockFile := filepath.Join(dir, fmt.Sprintf("%x.lock", sha256.Sum256([]byte(key))))
+	fileLock := flock.New(lockFile)
+	ok, err := fileLock.TryLock()
+	if err != nil {
+		return nil, fmt.Errorf("could not lock %s: %v", lockFile, err)
+	}
+	if !ok {
+		log.Printf("Waiting for another Bazelisk process to finish downloading %s...", key)
+		ok, err = fileLock.TryLockContext(ctx, DownloadLockPollInterval)
+		if !ok || err != nil {
+			return nil, fmt.Errorf("could not lock %s: %v", lockFile, err)
+		}
+	}
+	return func() {
+		_ = fileLock.Unlock()
+	}, nil
+}
+
+// GetDownloadLockTimeout returns how long to wait for the lock of LockDownload according to the config.
+func GetDownloadLockTimeout(config config.Config) (time.Duration, error) {
+	value := config.Get(DownloadLockTimeoutEnv)
+	if value == "" {
+		return DownloadLockTimeout, nil
+	}
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout < 0 {
+		return 0, fmt.Errorf("invalid duration %q in %s", value, DownloadLockTimeoutEnv)
+	}
+	return timeout, nil
+}
@@ -0,0 +1,95 @@
+package httputil
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bazelbuild/bazelisk/config"
+)
+
+func TestLockDownloadIsExclusive(t *testing.T) {
+	cfg := config.Static(map[string]string{DownloadLockDirEnv: t.TempDir()})
+	unlock, err := LockDownload(context.Background(), "", "https://example.com/bazel", cfg)
+	if err != nil {
+		t.Fatalf("Could not acquire lock: %v", err)
+	}
+
+	acquired := make(chan struct{})
+	go func() {
+		unlockSecond, err := LockDownload(context.Background(), "", "https://example.com/bazel", cfg)
+		if err != nil {
+			t.Errorf("Could not acquire lock: %v", err)
+		} else {
+			unlockSecond()
+		}
+		close(acquired)
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("Expected second lock to wait for the first one")
+	case <-time.After(300 * time.Millisecond):
+	}
+	unlock()
+	select {
+	case <-acquired:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected second lock to be acquired after the first one was released")
+	}
+}
+
+func TestLockDownloadDifferentKeys(t *testing.T) {
+	cfg := config.Static(map[string]string{DownloadLockDirEnv: t.TempDir()})
+	unlock, err := LockDownload(context.Background(), "", "https://example.com/bazel-1", cfg)
+	if err != nil {
+		t.Fatalf("Could not acquire lock: %v", err)
+	}
+	defer unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	unlockOther, err := LockDownload(ctx, "", "https://example.com/bazel-2", cfg)
+	if err != nil {
+		t.Fatalf("Expected locks for different keys to be independent, but got %v", err)
+	}
+	unlockOther()
+}
+
+func TestLockDownloadCancelled(t *testing.T) {
+	cfg := config.Static(map[string]string{DownloadLockDirEnv: t.TempDir()})
+	unlock, err := LockDownload(context.Background(), "", "https://example.com/bazel", cfg)
+	if err != nil {
+		t.Fatalf("Could not acquire lock: %v", err)
+	}
+	defer unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if _, err := LockDownload(ctx, "", "https://example.com/bazel", cfg); err == nil {
+		t.Fatal("Expected waiting for the lock to fail when the context is done")
+	}
+}
+
+func TestLockDownloadDefaultsToBazeliskHome(t *testing.T) {
+	bazeliskHome := t.TempDir()
+	unlock, err := LockDownload(context.Background(), bazeliskHome, "https://example.com/bazel", config.Null())
+	if err != nil {
+		t.Fatalf("Could not acquire lock: %v", err)
+	}
+	defer unlock()
+
+	locks, err := os.ReadDir(filepath.Join(bazeliskHome, "downloads", "locks"))
+	if err != nil || len(locks) != 1 {
+		t.Errorf("Expected a single lock file in the Bazelisk home, but got %v (%v)", locks, err)
+	}
+}
+
+func TestInvalidDownloadLockTimeout(t *testing.T) {
+	cfg := config.Static(map[string]string{DownloadLockTimeoutEnv: "soon"})
+	if _, err := GetDownloadLockTimeout(cfg); err == nil {
+		t.Fatal("Expected invalid timeout to be rejected")
+	}
+}
@@ -0,0 +1,176 @@
+package httputil
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	homedir "github.com/mitchellh/go-homedir"
+
+	"github.com/bazelbuild/bazelisk/config"
+)
+
+const (
+	// CredentialHelperEnv is the name of the config value that lists the credential helpers for downloads.
+	// Its format mirrors Bazel's --credential_helper flag: "[<scope>=]<path>[;[<scope>=]<path>...]",
+	// where scope is either a host name or a wildcard such as "*.example.com".
+	CredentialHelperEnv = "BAZELISK_CREDENTIAL_HELPER"
+)
+
+var (
+	// CredentialHelperTimeout specifies how long a credential helper may run before it is killed.
+	CredentialHelperTimeout = 10 * time.Second
+	// CredentialHelperCacheDuration specifies how long credentials are cached if the helper does not return an expiry date.
+	CredentialHelperCacheDuration = 30 * time.Minute
+
+	credentialCache = &credentialsCache{entries: make(map[string]*cachedCredentials)}
+)
+
+// credentialHelperRequest is the JSON object that is passed to a credential helper via stdin.
+// See https://github.com/EngFlow/credential-helper-spec/blob/main/spec.md.
+type credentialHelperRequest struct {
+	URI string `json:"uri"`
+}
+
+// credentialHelperResponse is the JSON object that a credential helper writes to stdout.
+type credentialHelperResponse struct {
+	Headers map[string][]string `json:"headers"`
+	Expires string              `json:"expires"`
+}
+
+type cachedCredentials struct {
+	headers map[string]string
+	expires time.Time
+}
+
+type credentialsCache struct {
+	mu      sync.Mutex
+	entries map[string]*cachedCredentials
+}
+
+func (c *credentialsCache) get(key string) map[string]string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok || !RetryClock.Now().Before(entry.expires) {
+		delete(c.entries, key)
+		return nil
+	}
+	return entry.headers
+}
+
+func (c *credentialsCache) put(key string, headers map[string]string, expires time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = &cachedCredentials{headers: headers, expires: expires}
+}
+
+// credentialHelperHeaders returns the headers that the configured credential helper for the given URL returns, if any.
+func credentialHelperHeaders(ctx context.Context, u *url.URL, config config.Config) (map[string]string, error) {
+	helper, err := findCredentialHelper(u.Hostname(), config.Get(CredentialHelperEnv))
+	if err != nil || helper == "" {
+		return nil, err
+	}
+
+	uri := u.String()
+	key := helper + "\x00" + uri
+	if headers := credentialCache.get(key); headers != nil {
+		return headers, nil
+	}
+
+	headers, expires, err := runCredentialHelper(ctx, helper, uri)
+	if err != nil {
+		return nil, err
+	}
+	credentialCache.put(key, headers, expires)
+	return headers, nil
+}
+
+// findCredentialHelper returns the path of the most specific credential helper for the given host:
+// a helper for the exact host wins over the helper with the longest matching wildcard scope, which wins over a helper without scope.
+// Like in Bazel, a later entry for the same scope overrides earlier ones.
+func findCredentialHelper(host, value string) (string, error) {
+	var exactHelper, wildcardHelper, defaultHelper, wildcardScope string
+	for _, entry := range strings.Split(value, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		scope, path, hasScope := strings.Cut(entry, "=")
+		if !hasScope {
+			defaultHelper = entry
+			continue
+		}
+		if scope == "" || path == "" {
+			return "", fmt.Errorf("invalid entry %q in %s, expected [<scope>=]<path>", entry, CredentialHelperEnv)
+		}
+		if scope == host {
+			exactHelper = path
+		} else if domain, ok := strings.CutPrefix(scope, "*."); ok && (host == domain || strings.HasSuffix(host, "."+domain)) {
+			if len(scope) >= len(wildcardScope) {
+				wildcardScope, wildcardHelper = scope, path
+			}
+		}
+	}
+	for _, helper := range []string{exactHelper, wildcardHelper, defaultHelper} {
+		if helper != "" {
+			return expandHelperPath(helper)
+		}
+	}
+	return "", nil
+}
+
+func expandHelperPath(path string) (string, error) {
+	expanded, err := homedir.Expand(path)
+	if err != nil {
+		return "", fmt.Errorf("could not expand home directory in credential helper path %s: %v", path, err)
+	}
+	return expanded, nil
+}
+
+// runCredentialHelper invokes the given credential helper for the URI and returns the headers it provided, as well as their expiry date.
+func runCredentialHelper(ctx context.Context, helper, uri string) (map[string]string, time.Time, error) {
+	request, err := json.Marshal(&credentialHelperRequest{URI: uri})
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, CredentialHelperTimeout)
+	defer cancel()
+
+	var stdout bytes.Buffer
+	cmd := exec.CommandContext(ctx, helper, "get")
+	cmd.Stdin = bytes.NewReader(request)
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return nil, time.Time{}, fmt.Errorf("credential helper %s failed for %s: %v", helper, uri, err)
+	}
+
+	var response credentialHelperResponse
+	if err := json.Unmarshal(stdout.Bytes(), &response); err != nil {
+		return nil, time.Time{}, fmt.Errorf("could not parse response of credential helper %s: %v", helper, err)
+	}
+
+	headers := make(map[string]string, len(response.Headers))
+	for name, values := range response.Headers {
+		headers[http.CanonicalHeaderKey(name)] = strings.Join(values, ", ")
+	}
+
+	expires := RetryClock.Now().Add(CredentialHelperCacheDuration)
+	if response.Expires != "" {
+		expires, err = time.Parse(time.RFC3339, response.Expires)
+		if err != nil {
+			return nil, time.Time{}, fmt.Errorf("credential helper %s returned invalid expiry date %q: %v", helper, response.Expires, err)
+		}
+	}
+	return headers, expires, nil
+}
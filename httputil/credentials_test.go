@@ -0,0 +1,258 @@
+package httputil
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bazelbuild/bazelisk/config"
+)
+
+func TestFindCredentialHelper(t *testing.T) {
+	value := "/default/helper; *.example.com=/wildcard/helper;*.corp.example.com=/corp/helper;mirror.example.com=/exact/helper"
+	tests := []struct {
+		host string
+		want string
+	}{
+		{host: "mirror.example.com", want: "/exact/helper"},
+		{host: "example.com", want: "/wildcard/helper"},
+		{host: "foo.example.com", want: "/wildcard/helper"},
+		{host: "a.corp.example.com", want: "/corp/helper"},
+		{host: "github.com", want: "/default/helper"},
+	}
+
+	for _, tc := range tests {
+		got, err := findCredentialHelper(tc.host, value)
+		if err != nil {
+			t.Fatalf("findCredentialHelper(%q): unexpected error %v", tc.host, err)
+		}
+		if got != tc.want {
+			t.Errorf("findCredentialHelper(%q) = %q, want %q", tc.host, got, tc.want)
+		}
+	}
+
+	if got, _ := findCredentialHelper("github.com", "*.example.com=/wildcard/helper"); got != "" {
+		t.Errorf("Expected no helper for unmatched host, but got %q", got)
+	}
+	if _, err := findCredentialHelper("github.com", "=/no/scope"); err == nil {
+		t.Errorf("Expected error for empty scope")
+	}
+
+	// Like in Bazel, later entries for the same scope win.
+	overrides := "/first/default;*.example.com=/first/wildcard;mirror.example.com=/first/exact;/second/default;*.example.com=/second/wildcard;mirror.example.com=/second/exact"
+	for host, want := range map[string]string{"github.com": "/second/default", "foo.example.com": "/second/wildcard", "mirror.example.com": "/second/exact"} {
+		if got, _ := findCredentialHelper(host, overrides); got != want {
+			t.Errorf("findCredentialHelper(%q) = %q, want %q", host, got, want)
+		}
+	}
+}
+
+// writeFakeHelper creates a credential helper script that records each invocation and prints the given response.
+func writeFakeHelper(t *testing.T, response string) (string, string) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake credential helper is a shell script")
+	}
+	dir := t.TempDir()
+	invocations := filepath.Join(dir, "invocations")
+	helper := filepath.Join(dir, "helper.sh")
+	script := fmt.Sprintf("#!/bin/sh\n[ \"$1\" = get ] || exit 1\ncat >> %q\necho >> %q\ncat <<'EOF'\n%s\nEOF\n", invocations, invocations, response)
+	if err := os.WriteFile(helper, []byte(script), 0755); err != nil {
+		t.Fatalf("Could not write fake credential helper: %v", err)
+	}
+	return helper, invocations
+}
+
+func countInvocations(t *testing.T, path string) int {
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return 0
+	} else if err != nil {
+		t.Fatalf("Could not read invocations of fake credential helper: %v", err)
+	}
+	return strings.Count(string(content), "\n")
+}
+
+func TestCredentialHelperHeaders(t *testing.T) {
+	_, clock := setUp()
+	helper, invocations := writeFakeHelper(t, `{"headers": {"Authorization": ["Bearer secret"], "X-Multi": ["a", "b"]}}`)
+	cfg := config.Static(map[string]string{CredentialHelperEnv: "mirror.example.com=" + helper})
+
+	for i := 0; i < 2; i++ {
+		got, err := DownloadHeaders(context.Background(), "https://mirror.example.com/bazel", "", cfg)
+		if err != nil {
+			t.Fatalf("DownloadHeaders(): unexpected error %v", err)
+		}
+		if got["Authorization"] != "Bearer secret" || got["X-Multi"] != "a, b" {
+			t.Errorf("DownloadHeaders() = %v, expected headers from credential helper", got)
+		}
+	}
+	if got := countInvocations(t, invocations); got != 1 {
+		t.Errorf("Expected cached credentials after the first invocation, but helper ran %d times", got)
+	}
+
+	clock.Sleep(CredentialHelperCacheDuration + time.Second)
+	if _, err := DownloadHeaders(context.Background(), "https://mirror.example.com/bazel", "", cfg); err != nil {
+		t.Fatalf("DownloadHeaders(): unexpected error %v", err)
+	}
+	if got := countInvocations(t, invocations); got != 2 {
+		t.Errorf("Expected helper to run again after the cache expired, but it ran %d times", got)
+	}
+
+	content, _ := os.ReadFile(invocations)
+	if !strings.Contains(string(content), `"uri":"https://mirror.example.com/bazel"`) {
+		t.Errorf("Expected helper to receive the URI via stdin, but got %q", content)
+	}
+}
+
+func TestCredentialHelperExpires(t *testing.T) {
+	setUp()
+	helper, invocations := writeFakeHelper(t, `{"headers": {"Authorization": ["Bearer secret"]}, "expires": "2000-01-01T00:00:00Z"}`)
+	cfg := config.Static(map[string]string{CredentialHelperEnv: helper})
+
+	for i := 0; i < 2; i++ {
+		if _, err := DownloadHeaders(context.Background(), "https://expired.example.com/bazel", "", cfg); err != nil {
+			t.Fatalf("DownloadHeaders(): unexpected error %v", err)
+		}
+	}
+	if got := countInvocations(t, invocations); got != 2 {
+		t.Errorf("Expected expired credentials not to be cached, but helper ran %d times", got)
+	}
+}
+
+func TestCredentialHelperDoesNotOverrideExplicitAuth(t *testing.T) {
+	helper, invocations := writeFakeHelper(t, `{"headers": {"Authorization": ["Bearer secret"]}}`)
+	cfg := config.Static(map[string]string{CredentialHelperEnv: helper})
+
+	got, err := DownloadHeaders(context.Background(), "https://github.com/fork/bazel", "token abc", cfg)
+	if err != nil {
+		t.Fatalf("DownloadHeaders(): unexpected error %v", err)
+	}
+	if got["Authorization"] != "token abc" {
+		t.Errorf("Expected explicit credentials to win, but got %v", got)
+	}
+	if got := countInvocations(t, invocations); got != 0 {
+		t.Errorf("Expected helper not to run, but it ran %d times", got)
+	}
+}
+
+func TestFailingCredentialHelper(t *testing.T) {
+	helper, _ := writeFakeHelper(t, "not json")
+	netrc := writeNetrc(t, "machine failing.example.com login user password secret\n")
+	cfg := config.Static(map[string]string{CredentialHelperEnv: helper, NetrcEnv: netrc})
+
+	got, err := DownloadHeaders(context.Background(), "https://failing.example.com/bazel", "", cfg)
+	if err != nil {
+		t.Fatalf("DownloadHeaders(): unexpected error %v", err)
+	}
+	if want := basicAuth("user", "secret"); got["Authorization"] != want {
+		t.Errorf("Expected fallback to netrc credentials %q, but got %v", want, got)
+	}
+}
+
+func TestCredentialHelperHeaderNamesAreCanonical(t *testing.T) {
+	helper, _ := writeFakeHelper(t, `{"headers": {"authorization": ["Bearer secret"], "x-api-key": ["from helper"]}}`)
+	cfg := config.Static(map[string]string{
+		CredentialHelperEnv: helper,
+		HTTPHeadersEnv:      "canonical.example.com=X-Api-Key:configured",
+	})
+
+	got, err := DownloadHeaders(context.Background(), "https://canonical.example.com/bazel", "", cfg)
+	if err != nil {
+		t.Fatalf("DownloadHeaders(): unexpected error %v", err)
+	}
+	want := map[string]string{"Authorization": "Bearer secret", "X-Api-Key": "configured"}
+	if len(got) != len(want) || got["Authorization"] != want["Authorization"] || got["X-Api-Key"] != want["X-Api-Key"] {
+		t.Errorf("DownloadHeaders() = %v, want %v", got, want)
+	}
+}
+
+func TestCredentialHelperHeadersAreDroppedOnRedirect(t *testing.T) {
+	url, _, received := startRedirectServers(t)
+	setUpRealTransport(t)
+	helper, _ := writeFakeHelper(t, `{"headers": {"X-Api-Key": ["secret"]}}`)
+	// The helper is only invoked for the original URL, even though it isn't restricted to a host.
+	cfg := config.Static(map[string]string{CredentialHelperEnv: helper})
+
+	if _, err := DownloadBinary(context.Background(), url, t.TempDir(), "bazel", cfg); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if len(*received) == 0 {
+		t.Fatal("Expected the download to be redirected")
+	}
+	for _, h := range *received {
+		if got := h.Get("X-Api-Key"); got != "" {
+			t.Errorf("Expected the credential helper's X-Api-Key not to be sent to the redirect target, but got %q", got)
+		}
+	}
+}
+
+func writeNetrc(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "netrc")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("Could not write netrc file: %v", err)
+	}
+	return path
+}
+
+func basicAuth(login, password string) string {
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(login+":"+password))
+}
+
+func TestNetrcCredentials(t *testing.T) {
+	path := writeNetrc(t, "machine mirror.example.com login user password secret\ndefault login anonymous password guest\n")
+	cfg := config.Static(map[string]string{NetrcEnv: path})
+
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{url: "https://mirror.example.com/bazel", want: basicAuth("user", "secret")},
+		{url: "https://mirror.example.com:8443/bazel", want: basicAuth("user", "secret")},
+		{url: "https://other.example.com/bazel", want: basicAuth("anonymous", "guest")},
+	}
+	for _, tc := range tests {
+		got, err := DownloadHeaders(context.Background(), tc.url, "", cfg)
+		if err != nil {
+			t.Fatalf("DownloadHeaders(%q): unexpected error %v", tc.url, err)
+		}
+		if got["Authorization"] != tc.want {
+			t.Errorf("DownloadHeaders(%q) returned Authorization %q, want %q", tc.url, got["Authorization"], tc.want)
+		}
+	}
+}
+
+func TestNetrcLocation(t *testing.T) {
+	envPath := writeNetrc(t, "machine mirror.example.com login env password env\n")
+	configPath := writeNetrc(t, "machine mirror.example.com login config password config\n")
+	t.Setenv("NETRC", envPath)
+
+	got, err := DownloadHeaders(context.Background(), "https://mirror.example.com/bazel", "", config.Null())
+	if err != nil {
+		t.Fatalf("DownloadHeaders(): unexpected error %v", err)
+	}
+	if want := basicAuth("env", "env"); got["Authorization"] != want {
+		t.Errorf("Expected credentials from $NETRC (%q), but got %q", want, got["Authorization"])
+	}
+
+	got, err = DownloadHeaders(context.Background(), "https://mirror.example.com/bazel", "", config.Static(map[string]string{NetrcEnv: configPath}))
+	if err != nil {
+		t.Fatalf("DownloadHeaders(): unexpected error %v", err)
+	}
+	if want := basicAuth("config", "config"); got["Authorization"] != want {
+		t.Errorf("Expected %s to take precedence over $NETRC (%q), but got %q", NetrcEnv, want, got["Authorization"])
+	}
+}
+
+func TestVerbosity(t *testing.T) {
+	for value, want := range map[string]int{"": 0, "1": 1, "2": 2, "-1": 0, "debug": 0} {
+		if got := Verbosity(config.Static(map[string]string{VerbosityEnv: value})); got != want {
+			t.Errorf("Verbosity(%q) = %d, want %d", value, got, want)
+		}
+	}
+}
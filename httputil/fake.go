@@ -4,12 +4,22 @@ import (
 	"bytes"
 	"io"
 	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
 )
 
 // FakeTransport represents a fake http.Transport that returns prerecorded responses.
+// It is safe for concurrent use.
 type FakeTransport struct {
+	mu        sync.Mutex
 	responses map[string]*responseCollection
+	rules     []*matchRule
 
+	// RequestedURLs contains all URLs that have been requested so far. It is updated while holding an internal lock.
+	//
+	// Deprecated: Reading this field races with concurrent requests. Use Requests instead.
 	RequestedURLs []string
 }
 
@@ -29,24 +39,153 @@ func (ft *FakeTransport) responseCollection(url string) *responseCollection {
 
 // AddResponse stores a fake HTTP response for the given URL.
 func (ft *FakeTransport) AddResponse(url string, status int, body string, headers map[string]string) {
+	ft.mu.Lock()
+	defer ft.mu.Unlock()
 	ft.responseCollection(url).Add(createResponse(status, body, headers), nil)
 }
 
 // AddError stores a error for the given URL.
 func (ft *FakeTransport) AddError(url string, err error) {
+	ft.mu.Lock()
+	defer ft.mu.Unlock()
 	ft.responseCollection(url).Add(nil, err)
 
 }
 
+// RequestMatcher selects the requests that a prerecorded response applies to. Empty fields match any request.
+type RequestMatcher struct {
+	// Method is the HTTP method, e.g. "GET" or "HEAD".
+	Method string
+	// URLPattern is a regular expression that has to match the entire URL.
+	URLPattern string
+	// Headers contains request headers that must have exactly the given values.
+	Headers map[string]string
+}
+
+type matchRule struct {
+	method    string
+	url       *regexp.Regexp
+	headers   map[string]string
+	responses *responseCollection
+}
+
+func (mr *matchRule) matches(req *http.Request) bool {
+	if mr.method != "" && mr.method != req.Method {
+		return false
+	}
+	if mr.url != nil && !mr.url.MatchString(req.URL.String()) {
+		return false
+	}
+	for k, v := range mr.headers {
+		if req.Header.Get(k) != v {
+			return false
+		}
+	}
+	return true
+}
+
+// AddMatchingResponse stores a fake HTTP response for all requests that match the given matcher.
+// Responses for exact URLs that were added via AddResponse take precedence.
+// If multiple matchers apply to a request, the first one with unused responses wins.
+// It panics if the URL pattern is not a valid regular expression.
+func (ft *FakeTransport) AddMatchingResponse(matcher RequestMatcher, status int, body string, headers map[string]string) {
+	ft.addRule(matcher, createResponse(status, body, headers), nil)
+}
+
+// AddMatchingError stores an error for all requests that match the given matcher.
+func (ft *FakeTransport) AddMatchingError(matcher RequestMatcher, err error) {
+	ft.addRule(matcher, nil, err)
+}
+
+func (ft *FakeTransport) addRule(matcher RequestMatcher, resp *http.Response, err error) {
+	rule := &matchRule{
+		method:    matcher.Method,
+		headers:   matcher.Headers,
+		responses: &responseCollection{},
+	}
+	if matcher.URLPattern != "" {
+		rule.url = regexp.MustCompile("^(?:" + matcher.URLPattern + ")$")
+	}
+	rule.responses.Add(resp, err)
+
+	ft.mu.Lock()
+	defer ft.mu.Unlock()
+	ft.rules = append(ft.rules, rule)
+}
+
 // RoundTrip returns a prerecorded response to the given request, if one exists. Otherwise its response indicates 404 - not found.
 func (ft *FakeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ft.mu.Lock()
+	defer ft.mu.Unlock()
 	ft.RequestedURLs = append(ft.RequestedURLs, req.URL.String())
 	if responses, ok := ft.responses[req.URL.String()]; ok {
 		return responses.Next()
 	}
+	for _, rule := range ft.rules {
+		if rule.responses.HasNext() && rule.matches(req) {
+			return rule.responses.Next()
+		}
+	}
 	return notFound(), nil
 }
 
+// Requests returns a copy of all URLs that have been requested so far.
+func (ft *FakeTransport) Requests() []string {
+	ft.mu.Lock()
+	defer ft.mu.Unlock()
+	return append([]string(nil), ft.RequestedURLs...)
+}
+
+// TestingT is the subset of testing.TB that the assertion helpers of FakeTransport need.
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+}
+
+// AssertRequested reports an error unless all given URLs have been requested in the given order.
+// Other requests may have happened in between.
+func (ft *FakeTransport) AssertRequested(t TestingT, urls ...string) {
+	t.Helper()
+	requests := ft.Requests()
+	next := 0
+	for _, r := range requests {
+		if next < len(urls) && r == urls[next] {
+			next++
+		}
+	}
+	if next < len(urls) {
+		t.Errorf("Expected request to %s, but got requests:\n%s", urls[next], strings.Join(requests, "\n"))
+	}
+}
+
+// AssertNotRequested reports an error if any of the given URLs has been requested.
+func (ft *FakeTransport) AssertNotRequested(t TestingT, urls ...string) {
+	t.Helper()
+	for _, r := range ft.Requests() {
+		for _, u := range urls {
+			if r == u {
+				t.Errorf("Expected no request to %s", u)
+			}
+		}
+	}
+}
+
+// AssertRequestCount reports an error unless exactly n requested URLs match the given regular expression.
+func (ft *FakeTransport) AssertRequestCount(t TestingT, urlPattern string, n int) {
+	t.Helper()
+	pattern := regexp.MustCompile("^(?:" + urlPattern + ")$")
+	requests := ft.Requests()
+	count := 0
+	for _, r := range requests {
+		if pattern.MatchString(r) {
+			count++
+		}
+	}
+	if count != n {
+		t.Errorf("Expected %d requests matching %s, but got %d:\n%s", n, urlPattern, count, strings.Join(requests, "\n"))
+	}
+}
+
 type responseCollection struct {
 	all  []responseError
 	next int
@@ -56,6 +195,10 @@ func (rc *responseCollection) Add(resp *http.Response, err error) {
 	rc.all = append(rc.all, responseError{resp: resp, err: err})
 }
 
+func (rc *responseCollection) HasNext() bool {
+	return rc.next < len(rc.all)
+}
+
 func (rc *responseCollection) Next() (*http.Response, error) {
 	if rc.next >= len(rc.all) {
 		return notFound(), nil
@@ -66,17 +209,25 @@ func (rc *responseCollection) Next() (*http.Response, error) {
 }
 
 func createResponse(status int, body string, headers map[string]string) *http.Response {
+	contentLength := int64(len(body))
+	// Allow tests to simulate truncated bodies.
+	if value, ok := headers["Content-Length"]; ok {
+		if parsed, err := strconv.ParseInt(value, 10, 64); err == nil {
+			contentLength = parsed
+		}
+	}
 	return &http.Response{
-		StatusCode: status,
-		Body:       io.NopCloser(bytes.NewBufferString(body)),
-		Header:     transformHeaders(headers),
+		StatusCode:    status,
+		Body:          io.NopCloser(bytes.NewBufferString(body)),
+		ContentLength: contentLength,
+		Header:        transformHeaders(headers),
 	}
 }
 
 func transformHeaders(original map[string]string) http.Header {
-	result := make(map[string][]string)
+	result := make(http.Header)
 	for k, v := range original {
-		result[k] = []string{v}
+		result.Set(k, v)
 	}
 	return result
 }
@@ -2,7 +2,9 @@
 package httputil
 
 import (
+	"context"
 	b64 "encoding/base64"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -12,7 +14,9 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"runtime"
 	"strconv"
+	"strings"
 	"time"
 
 	netrc "github.com/bgentry/go-netrc/netrc"
@@ -22,6 +26,15 @@ import (
 	"github.com/bazelbuild/bazelisk/httputil/progress"
 )
 
+const (
+	// NetrcEnv is the name of the config value that overrides the location of the netrc file.
+	NetrcEnv = "BAZELISK_NETRC"
+	// VerbosityEnv is the name of the config value that controls how much Bazelisk logs.
+	VerbosityEnv = "BAZELISK_VERBOSITY"
+	// HTTPHeadersEnv is the name of the config value that contains additional HTTP headers for downloads from specific hosts.
+	HTTPHeadersEnv = "BAZELISK_HTTP_HEADERS"
+)
+
 var (
 	// DefaultTransport specifies the http.RoundTripper that is used for any network traffic, and may be replaced with a dummy implementation for unit testing.
 	DefaultTransport = http.DefaultTransport
@@ -35,9 +48,35 @@ var (
 	MaxRetries = 4
 	// MaxRequestDuration defines the maximum amount of time that a request and its retries may take in total
 	MaxRequestDuration = time.Second * 30
-	retryHeaders       = []string{"Retry-After", "X-RateLimit-Reset", "Rate-Limit-Reset"}
+	// MaxDownloadDuration defines the maximum amount of time that a binary download may take in total, including all
+	// retries and waiting for rate limits to reset.
+	MaxDownloadDuration = time.Hour
+	// X-RateLimit-Reset contains a timestamp instead of a duration, so it's handled by rateLimitReset() instead.
+	retryHeaders = []string{"Retry-After", "Rate-Limit-Reset"}
+
+	// ErrNotFound is wrapped by the errors of requests and downloads that failed because the server responded with
+	// 404 Not Found or 410 Gone, as opposed to transient failures such as network errors.
+	ErrNotFound = errors.New("not found")
 )
 
+// notFoundError describes a request for a resource that doesn't exist. It wraps ErrNotFound without repeating it
+// in the message.
+type notFoundError struct {
+	msg string
+}
+
+func (e *notFoundError) Error() string {
+	return e.msg
+}
+
+func (e *notFoundError) Unwrap() error {
+	return ErrNotFound
+}
+
+func isNotFound(res *http.Response) bool {
+	return res != nil && (res.StatusCode == http.StatusNotFound || res.StatusCode == http.StatusGone)
+}
+
 // Clock keeps track of time. It can return the current time, as well as move forward by sleeping for a certain period.
 type Clock interface {
 	Sleep(time.Duration)
@@ -58,15 +97,27 @@ func (*realClock) Now() time.Time {
 // If the request fails with a transient error it will retry the request for at most MaxRetries times.
 // It obeys HTTP headers such as "Retry-After" when calculating the start time of the next attempt.
 // If no such header is present, it uses an exponential backoff strategy.
-func ReadRemoteFile(url string, auth string) ([]byte, http.Header, error) {
-	res, err := get(url, auth)
+func ReadRemoteFile(ctx context.Context, url string, auth string) ([]byte, http.Header, error) {
+	return ReadRemoteFileWithHeaders(ctx, url, authHeaders(auth))
+}
+
+// ReadRemoteFileWithHeaders behaves like ReadRemoteFile, but sends the given HTTP headers (e.g. "Accept" or "Authorization") with every request.
+func ReadRemoteFileWithHeaders(ctx context.Context, url string, headers map[string]string) ([]byte, http.Header, error) {
+	res, err := get(ctx, url, headers)
 	if err != nil {
 		return nil, nil, fmt.Errorf("could not fetch %s: %v", url, err)
 	}
 	defer res.Body.Close()
 
+	if res.StatusCode == http.StatusNotModified {
+		return nil, res.Header, errNotModified
+	}
 	if res.StatusCode != 200 {
-		return nil, res.Header, fmt.Errorf("unexpected status code while reading %s: %v", url, res.StatusCode)
+		err := fmt.Errorf("unexpected status code while reading %s: %v", url, res.StatusCode)
+		if isNotFound(res) {
+			err = &notFoundError{err.Error()}
+		}
+		return nil, res.Header, err
 	}
 
 	body, err := io.ReadAll(res.Body)
@@ -76,26 +127,63 @@ func ReadRemoteFile(url string, auth string) ([]byte, http.Header, error) {
 	return body, res.Header, nil
 }
 
-func get(url, auth string) (*http.Response, error) {
+// Get sends a GET request with the given headers and returns the response, whose body has to be closed by the caller.
+// Like ReadRemoteFile, it retries transient failures and waits for exhausted rate limits to reset.
+// Unlike ReadRemoteFile, it also returns responses with unsuccessful status codes.
+func Get(ctx context.Context, url string, headers map[string]string) (*http.Response, error) {
+	return get(ctx, url, headers)
+}
+
+func authHeaders(auth string) map[string]string {
+	if auth == "" {
+		return nil
+	}
+	return map[string]string{"Authorization": auth}
+}
+
+func get(ctx context.Context, url string, headers map[string]string) (*http.Response, error) {
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
 		return nil, fmt.Errorf("could not create request: %v", err)
 	}
 
 	req.Header.Set("User-Agent", UserAgent)
-	if auth != "" {
-		req.Header.Set("Authorization", auth)
+	for k, v := range headers {
+		req.Header.Set(k, v)
 	}
-	client := &http.Client{Transport: DefaultTransport}
+	client := newClient(headers)
 	deadline := RetryClock.Now().Add(MaxRequestDuration)
 	var lastFailure string
+	waitedForRateLimit := false
 	for attempt := 0; attempt <= MaxRetries; attempt++ {
-		res, err := client.Do(req)
+		res, err := doWithTimeouts(ctx, client, req)
+		if ctx.Err() != nil {
+			if res != nil {
+				res.Body.Close()
+			}
+			return nil, fmt.Errorf("request to %s was cancelled: %v", url, ctx.Err())
+		}
+		logRateLimit(url, res)
+		if wait, limited := rateLimitReset(res); limited {
+			res.Body.Close()
+			// Only wait once, otherwise clock skew could keep us waiting forever.
+			if waitedForRateLimit || wait > MaxRateLimitWait {
+				return nil, rateLimitError(url, wait)
+			}
+			waitedForRateLimit = true
+			log.Printf("Rate limit for %s exceeded, waiting %v until it resets...", url, wait.Round(time.Second))
+			lastFailure = fmt.Sprintf("HTTP %d (rate limit exceeded)", res.StatusCode)
+			deadline = deadline.Add(wait)
+			if err := sleep(ctx, wait); err != nil {
+				return nil, fmt.Errorf("request to %s was cancelled: %v", url, err)
+			}
+			continue
+		}
 		if !shouldRetry(res, err) {
 			return res, err
 		}
 
-		if (res != nil) {
+		if res != nil {
 			// Need to retry, close the response body immediately to release resources.
 			// See https://github.com/googleapis/google-cloud-go/issues/7440#issuecomment-1491008639
 			res.Body.Close()
@@ -116,12 +204,30 @@ func get(url, auth string) (*http.Response, error) {
 			return nil, fmt.Errorf("unable to complete %d requests to %s within %v. Most recent failure: %s", attempt+1, url, MaxRequestDuration, lastFailure)
 		}
 		if attempt < MaxRetries {
-			RetryClock.Sleep(waitFor)
+			if err := sleep(ctx, waitFor); err != nil {
+				return nil, fmt.Errorf("request to %s was cancelled: %v", url, err)
+			}
 		}
 	}
 	return nil, fmt.Errorf("unable to complete request to %s after %d retries. Most recent failure: %s", url, MaxRetries, lastFailure)
 }
 
+// sleep waits for the given duration using RetryClock, and returns early with an error if the context is cancelled.
+func sleep(ctx context.Context, d time.Duration) error {
+	if _, ok := RetryClock.(*realClock); !ok {
+		RetryClock.Sleep(d)
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
 func shouldRetry(res *http.Response, err error) bool {
 	// Retry if the client failed to speak HTTP.
 	if err != nil {
@@ -156,14 +262,57 @@ func parseRetryHeader(value string) (time.Duration, error) {
 	return time.Until(t), nil
 }
 
-// tryFindNetrcFileCreds returns base64-encoded login:password found in ~/.netrc file for a given `host`
-func tryFindNetrcFileCreds(host string) (string, error) {
+// Verbosity returns the log verbosity configured via BAZELISK_VERBOSITY: 0 (default) only logs essential messages,
+// 1 also logs details such as the source of credentials, and 2 adds debug output.
+func Verbosity(config config.Config) int {
+	level, err := strconv.Atoi(config.Get(VerbosityEnv))
+	if err != nil || level < 0 {
+		return 0
+	}
+	return level
+}
+
+func logAtVerbosity(config config.Config, level int, format string, args ...interface{}) {
+	if Verbosity(config) >= level {
+		log.Printf(format, args...)
+	}
+}
+
+// findNetrcFile returns the path of the netrc file to use. In order of precedence, this is the value of BAZELISK_NETRC,
+// the value of the NETRC environment variable, or the first existing file of ~/.netrc and ~/_netrc (reversed on Windows).
+func findNetrcFile(config config.Config) (string, error) {
+	if path := config.Get(NetrcEnv); path != "" {
+		return homedir.Expand(path)
+	}
+	if path := os.Getenv("NETRC"); path != "" {
+		return path, nil
+	}
+
 	dir, err := homedir.Dir()
 	if err != nil {
 		return "", err
 	}
+	names := []string{".netrc", "_netrc"}
+	if runtime.GOOS == "windows" {
+		names = []string{"_netrc", ".netrc"}
+	}
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+	return filepath.Join(dir, names[0]), nil
+}
+
+// tryFindNetrcFileCreds returns base64-encoded login:password found in the netrc file for a given `host`.
+// If the file has no entry for `host`, it returns the credentials of the "default" entry, if present.
+func tryFindNetrcFileCreds(host string, config config.Config) (string, error) {
+	file, err := findNetrcFile(config)
+	if err != nil {
+		return "", err
+	}
 
-	var file = filepath.Join(dir, ".netrc")
 	n, err := netrc.ParseFile(file)
 	if err != nil {
 		// netrc does not exist or we can't read it
@@ -171,21 +320,112 @@ func tryFindNetrcFileCreds(host string) (string, error) {
 	}
 
 	m := n.FindMachine(host)
+	if hostname, _, hasPort := strings.Cut(host, ":"); hasPort && (m == nil || m.IsDefault()) {
+		// Entries usually refer to host names without ports.
+		if withoutPort := n.FindMachine(hostname); withoutPort != nil {
+			m = withoutPort
+		}
+	}
 	if m == nil {
 		// if host is not found, we should proceed without providing any Authorization header,
 		// because remote host may not have auth at all.
-		log.Printf("Skipping basic authentication for %s because no credentials found in %s", host, file)
+		logAtVerbosity(config, 1, "Skipping basic authentication for %s because no credentials found in %s", host, file)
 		return "", fmt.Errorf("could not find creds for %s in netrc %s", host, file)
 	}
 
-	log.Printf("Using basic authentication credentials for host %s from %s", host, file)
+	if m.IsDefault() {
+		logAtVerbosity(config, 1, "Using default basic authentication credentials for host %s from %s", host, file)
+	} else {
+		logAtVerbosity(config, 1, "Using basic authentication credentials for host %s from %s", host, file)
+	}
 
 	token := b64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%s:%s", m.Login, m.Password)))
 	return fmt.Sprintf("Basic %s", token), nil
 }
 
 // DownloadBinary downloads a file from the given URL into the specified location, marks it executable and returns its full path.
-func DownloadBinary(originURL, destDir, destFile string, config config.Config) (string, error) {
+// It authenticates the request with the headers returned by DownloadHeaders.
+func DownloadBinary(ctx context.Context, originURL, destDir, destFile string, config config.Config) (string, error) {
+	headers, err := DownloadHeaders(ctx, originURL, "", config)
+	if err != nil {
+		return "", err
+	}
+	return DownloadBinaryWithHeaders(ctx, originURL, destDir, destFile, headers, config)
+}
+
+// DownloadHeaders returns the HTTP headers that should be sent when downloading the given URL.
+// It contains the headers configured for the URL's host via BAZELISK_HTTP_HEADERS. Unless those headers already
+// contain an "Authorization" entry, the given `auth` value is used. If `auth` is empty, the headers returned by
+// the configured credential helper are used, or Basic authentication credentials from the netrc file if there is no helper
+// or if the helper fails.
+// Repositories can use `auth` to pass their own credentials, e.g. a GitHub token.
+// Downloads only send these headers to the URL's host, but not to other hosts that the download redirects to.
+func DownloadHeaders(ctx context.Context, originURL, auth string, config config.Config) (map[string]string, error) {
+	u, err := url.Parse(originURL)
+	if err != nil {
+		return nil, err
+	}
+
+	headers, err := configuredHeaders(u.Host, config)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := headers["Authorization"]; ok {
+		return headers, nil
+	}
+	if auth != "" {
+		headers["Authorization"] = auth
+		return headers, nil
+	}
+
+	helperHeaders, err := credentialHelperHeaders(ctx, u, config)
+	if err != nil {
+		log.Printf("WARNING: %v, falling back to netrc", err)
+	}
+	if helperHeaders != nil {
+		for k, v := range helperHeaders {
+			if _, ok := headers[k]; !ok {
+				headers[k] = v
+			}
+		}
+	} else if t, err := tryFindNetrcFileCreds(u.Host, config); err == nil {
+		// successfully parsed netrc for given host
+		headers["Authorization"] = t
+	}
+	return headers, nil
+}
+
+// configuredHeaders returns the headers for the given host from the BAZELISK_HTTP_HEADERS config value,
+// which has the format "<host>=<name>:<value>[;<host>=<name>:<value>...]".
+func configuredHeaders(host string, config config.Config) (map[string]string, error) {
+	headers := make(map[string]string)
+	value := config.Get(HTTPHeadersEnv)
+	if value == "" {
+		return headers, nil
+	}
+
+	for _, entry := range strings.Split(value, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		entryHost, header, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid entry %q in %s, expected <host>=<name>:<value>", entry, HTTPHeadersEnv)
+		}
+		name, headerValue, ok := strings.Cut(header, ":")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("invalid header %q in %s, expected <name>:<value>", header, HTTPHeadersEnv)
+		}
+		if strings.TrimSpace(entryHost) == host {
+			headers[http.CanonicalHeaderKey(strings.TrimSpace(name))] = strings.TrimSpace(headerValue)
+		}
+	}
+	return headers, nil
+}
+
+// DownloadBinaryWithHeaders behaves like DownloadBinary, but authenticates the request with the given HTTP headers instead.
+func DownloadBinaryWithHeaders(ctx context.Context, originURL, destDir, destFile string, headers map[string]string, config config.Config) (string, error) {
 	err := os.MkdirAll(destDir, 0755)
 	if err != nil {
 		return "", fmt.Errorf("could not create directory %s: %v", destDir, err)
@@ -204,38 +444,29 @@ func DownloadBinary(originURL, destDir, destFile string, config config.Config) (
 			}
 		}()
 
-		u, err := url.Parse(originURL)
-		if err != nil {
-			// originURL supposed to be valid
-			return "", err
-		}
-
 		log.Printf("Downloading %s...", originURL)
 
-		var auth string = ""
-		t, err := tryFindNetrcFileCreds(u.Host)
-		if err == nil {
-			// successfully parsed netrc for given host
-			auth = t
+		limiter, err := newBandwidthLimiter(config)
+		if err != nil {
+			return "", err
 		}
-
-		resp, err := get(originURL, auth)
+		reporter, err := progress.NewReporter(config)
 		if err != nil {
-			return "", fmt.Errorf("HTTP GET %s failed: %v", originURL, err)
+			return "", err
 		}
-		defer resp.Body.Close()
-
-		if resp.StatusCode != 200 {
-			return "", fmt.Errorf("HTTP GET %s failed with error %v", originURL, resp.StatusCode)
+		chunked := false
+		if chunks, err := downloadChunks(config); err != nil {
+			return "", err
+		} else if chunks > 1 {
+			chunked, err = downloadInChunks(ctx, originURL, headers, tmpfile, chunks, limiter, reporter, config)
+			if err != nil {
+				return "", err
+			}
 		}
-
-		_, err = io.Copy(
-			// Add a progress bar during download.
-			progress.Writer(tmpfile, "Downloading", resp.ContentLength, config),
-			resp.Body)
-		progress.Finish(config)
-		if err != nil {
-			return "", fmt.Errorf("could not copy from %s to %s: %v", originURL, tmpfile.Name(), err)
+		if !chunked {
+			if err := downloadWithRetries(ctx, originURL, headers, tmpfile, limiter, reporter); err != nil {
+				return "", err
+			}
 		}
 
 		err = os.Chmod(tmpfile.Name(), 0755)
@@ -253,48 +484,205 @@ func DownloadBinary(originURL, destDir, destFile string, config config.Config) (
 	return destinationPath, nil
 }
 
-// ContentMerger is a function that merges multiple HTTP payloads into a single message.
-type ContentMerger func([][]byte) ([]byte, error)
+// downloadWithRetries downloads the given URL into the file. Unlike get(), it also retries if the response body
+// cannot be read completely, e.g. because the connection dropped or the body is shorter than its Content-Length.
+// The returned error lists all failed attempts.
+func downloadWithRetries(ctx context.Context, originURL string, headers map[string]string, file *os.File, limiter *bandwidthLimiter, reporter progress.Reporter) error {
+	req, err := newDownloadRequest(originURL, headers)
+	if err != nil {
+		return err
+	}
+	client := newClient(headers)
+	return retryDownload(ctx, originURL, func(ctx context.Context) (*http.Response, bool, error) {
+		return downloadAttempt(ctx, client, req, file, limiter, reporter)
+	})
+}
 
-// MaybeDownload downloads a file from the given url and caches the result under bazeliskHome.
-// It skips the download if the file already exists and is not outdated.
-// Parameter ´description´ is only used to provide better error messages.
-// Parameter `auth` is a value of "Authorization" HTTP header.
-func MaybeDownload(bazeliskHome, url, filename, description, auth string, merger ContentMerger) ([]byte, error) {
-	cachePath := filepath.Join(bazeliskHome, filename)
-	if cacheStat, err := os.Stat(cachePath); err == nil {
-		if time.Since(cacheStat.ModTime()).Hours() < 1 {
-			res, err := os.ReadFile(cachePath)
-			if err != nil {
-				return nil, fmt.Errorf("could not read %s: %v", cachePath, err)
+// newClient returns a client that only sends the given headers to the host of the original request. They may contain
+// credentials for that host, but http.Client only drops Authorization, Cookie and WWW-Authenticate when it follows a
+// redirect to another host.
+func newClient(headers map[string]string) *http.Client {
+	return &http.Client{
+		Transport: DefaultTransport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return errors.New("stopped after 10 redirects")
 			}
-			return res, nil
-		}
+			// http.Client copies the headers of the original request on every redirect, so they have to be
+			// dropped again even if a later redirect leads back to the original host.
+			leftHost := req.URL.Host != via[0].URL.Host
+			for _, r := range via[1:] {
+				leftHost = leftHost || r.URL.Host != via[0].URL.Host
+			}
+			if leftHost {
+				for k := range headers {
+					req.Header.Del(k)
+				}
+			}
+			return nil
+		},
 	}
+}
+
+func newDownloadRequest(originURL string, headers map[string]string) (*http.Request, error) {
+	req, err := http.NewRequest("GET", originURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("could not create request: %v", err)
+	}
+	req.Header.Set("User-Agent", UserAgent)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	return req, nil
+}
+
+// retryDownload calls attempt until it succeeds, fails permanently, MaxRetries is exhausted or MaxDownloadDuration
+// has passed. Between attempts it waits as long as getWaitPeriod() suggests. The description is only used in error
+// messages.
+func retryDownload(ctx context.Context, description string, attempt func(ctx context.Context) (*http.Response, bool, error)) error {
+	parent := ctx
+	ctx, cancel := context.WithTimeout(ctx, MaxDownloadDuration)
+	defer cancel()
+
+	var history []string
+	var lastResponse *http.Response
+	waitedForRateLimit := false
+	for i := 0; i <= MaxRetries; i++ {
+		res, retry, err := attempt(ctx)
+		logRateLimit(description, res)
+		if err == nil {
+			return nil
+		}
+		lastResponse = res
+		history = append(history, fmt.Sprintf("attempt %d: %v", i+1, err))
+		if ctx.Err() != nil {
+			return downloadAborted(parent, description, history)
+		}
+
+		rateLimitWait, limited := rateLimitReset(res)
+		if limited {
+			if waitedForRateLimit || rateLimitWait > MaxRateLimitWait {
+				return fmt.Errorf("could not download %s (%s): %v", description, strings.Join(history, "; "), rateLimitError(description, rateLimitWait))
+			}
+			waitedForRateLimit = true
+			retry = true
+		}
+		if !retry || i == MaxRetries {
+			break
+		}
 
-	contents := make([][]byte, 0)
-	nextURL := url
-	for nextURL != "" {
-		// We could also use go-github here, but I can't get it to build with Bazel's rules_go and it pulls in a lot of dependencies.
-		body, headers, err := ReadRemoteFile(nextURL, auth)
+		var requestErr error
+		if res == nil {
+			requestErr = err
+		}
+		waitFor, err := getWaitPeriod(res, requestErr, i)
 		if err != nil {
-			return nil, fmt.Errorf("could not download %s: %v", description, err)
+			return fmt.Errorf("could not download %s (%s): %v", description, strings.Join(history, "; "), err)
+		}
+		if limited {
+			log.Printf("Rate limit for %s exceeded, waiting %v until it resets...", description, rateLimitWait.Round(time.Second))
+			waitFor = rateLimitWait
+		} else if waitFor > MaxRequestDuration {
+			history = append(history, fmt.Sprintf("server asked to wait %v, which exceeds %v", waitFor, MaxRequestDuration))
+			break
+		}
+		if err := sleep(ctx, waitFor); err != nil {
+			return downloadAborted(parent, description, history)
 		}
-		contents = append(contents, body)
-		nextURL = getNextURL(headers)
 	}
+	err := fmt.Errorf("could not download %s after %d attempt(s): %s", description, len(history), strings.Join(history, "; "))
+	if isNotFound(lastResponse) {
+		return &notFoundError{err.Error()}
+	}
+	return err
+}
+
+// downloadAborted returns the error for a download that was cancelled via the parent context or took longer than
+// MaxDownloadDuration.
+func downloadAborted(parent context.Context, description string, history []string) error {
+	if parent.Err() != nil {
+		return fmt.Errorf("download of %s was cancelled (%s)", description, strings.Join(history, "; "))
+	}
+	return fmt.Errorf("download of %s did not finish within %v (%s)", description, MaxDownloadDuration, strings.Join(history, "; "))
+}
 
-	merged, err := merger(contents)
+// downloadAttempt sends the request once and writes the response body into the file, replacing any previous content.
+// It returns the response (whose body is already closed) if there was one, and whether a failure may be transient.
+func downloadAttempt(ctx context.Context, client *http.Client, req *http.Request, file *os.File, limiter *bandwidthLimiter, reporter progress.Reporter) (*http.Response, bool, error) {
+	if err := file.Truncate(0); err != nil {
+		return nil, false, fmt.Errorf("could not truncate %s: %v", file.Name(), err)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, false, fmt.Errorf("could not seek in %s: %v", file.Name(), err)
+	}
+
+	res, err := doWithTimeouts(ctx, client, req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to merge %d chunks from %s: %v", len(contents), url, err)
+		return nil, true, err
 	}
+	defer res.Body.Close()
 
-	err = os.WriteFile(cachePath, merged, 0666)
+	if res.StatusCode != 200 {
+		return res, shouldRetry(res, nil), fmt.Errorf("HTTP %d", res.StatusCode)
+	}
+
+	// Add a progress bar during download.
+	reporter.Start("Downloading", res.ContentLength, progress.Bytes)
+	written, err := io.Copy(progress.Writer(file, reporter), limiter.reader(ctx, res.Body))
+	reporter.Finish()
 	if err != nil {
-		return nil, fmt.Errorf("could not create %s: %v", cachePath, err)
+		return res, true, fmt.Errorf("could not read body after %d bytes: %v", written, err)
+	}
+	if res.ContentLength >= 0 && written != res.ContentLength {
+		return res, true, fmt.Errorf("body is truncated: received %d of %d bytes", written, res.ContentLength)
 	}
+	return res, false, nil
+}
+
+// ContentMerger is a function that merges multiple HTTP payloads into a single message.
+type ContentMerger func([][]byte) ([]byte, error)
 
-	return merged, nil
+// MaybeDownload downloads a file from the given url and caches the result under bazeliskHome.
+// It skips the download if the file is younger than ListingTTL, and otherwise sends a conditional request
+// for the first page, so that unchanged listings do not have to be downloaded again.
+// Parameter ´description´ is only used to provide better error messages.
+// Parameter `auth` is a value of "Authorization" HTTP header.
+func MaybeDownload(ctx context.Context, bazeliskHome, url, filename, description, auth string, merger ContentMerger) ([]byte, error) {
+	return readThroughCache(filepath.Join(bazeliskHome, filename), ListingTTL, func(validators *cacheValidators) ([]byte, *cacheValidators, error) {
+		var newValidators *cacheValidators
+		contents := make([][]byte, 0)
+		// Large repositories have many pages of releases, which can take a while.
+		progress.Default.Start("Fetching "+description, -1, progress.Pages)
+		defer progress.Default.Finish()
+		nextURL := url
+		for nextURL != "" {
+			headers := authHeaders(auth)
+			if nextURL == url {
+				// New entries always appear on the first page, so it's sufficient to check whether it has changed.
+				headers = validators.apply(headers)
+			}
+			// We could also use go-github here, but I can't get it to build with Bazel's rules_go and it pulls in a lot of dependencies.
+			body, resHeaders, err := ReadRemoteFileWithHeaders(ctx, nextURL, headers)
+			if errors.Is(err, errNotModified) {
+				return nil, nil, err
+			}
+			if err != nil {
+				return nil, nil, fmt.Errorf("could not download %s: %w", description, err)
+			}
+			if nextURL == url {
+				newValidators = validatorsFromHeaders(resHeaders)
+			}
+			contents = append(contents, body)
+			progress.Default.Update(int64(len(contents)))
+			nextURL = getNextURL(resHeaders)
+		}
+
+		merged, err := merger(contents)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to merge %d chunks from %s: %v", len(contents), url, err)
+		}
+		return merged, newValidators, nil
+	})
 }
 
 func getNextURL(headers http.Header) string {
@@ -1,12 +1,20 @@
 package httputil
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"maps"
 	"net/http"
+	"net/http/httptest"
+	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
+
+	"github.com/bazelbuild/bazelisk/config"
 )
 
 var (
@@ -60,7 +68,7 @@ func TestSuccessOnFirstTry(t *testing.T) {
 	url := "http://foo"
 	want := "the_body"
 	transport.AddResponse(url, 200, want, nil)
-	body, _, err := ReadRemoteFile(url, "")
+	body, _, err := ReadRemoteFile(context.Background(), url, "")
 
 	if err != nil {
 		t.Fatalf("Unexpected error %v", err)
@@ -79,7 +87,7 @@ func TestSuccessOnRetry(t *testing.T) {
 	want := "the_body"
 	transport.AddResponse(url, 503, "", nil)
 	transport.AddResponse(url, 200, want, nil)
-	body, _, err := ReadRemoteFile(url, "")
+	body, _, err := ReadRemoteFile(context.Background(), url, "")
 
 	if err != nil {
 		t.Fatalf("Unexpected error %v", err)
@@ -102,7 +110,7 @@ func TestSuccessOnRetryNonHTTPError(t *testing.T) {
 	want := "the_body"
 	transport.AddError(url, errors.New("boom"))
 	transport.AddResponse(url, 200, want, nil)
-	body, _, err := ReadRemoteFile(url, "")
+	body, _, err := ReadRemoteFile(context.Background(), url, "")
 
 	if err != nil {
 		t.Fatalf("Unexpected error %v", err)
@@ -125,7 +133,7 @@ func TestAllTriesFail(t *testing.T) {
 	retries := 5
 	_, clock := setUpAllFailures(url, 502, retries, nil)
 
-	_, _, err := ReadRemoteFile(url, "")
+	_, _, err := ReadRemoteFile(context.Background(), url, "")
 	if err == nil {
 		t.Fatal("Expected request to fail with code 502")
 	}
@@ -161,7 +169,7 @@ func TestShouldObeyRetryHeaders(t *testing.T) {
 			wanted := 5 * time.Hour
 			_, clock := setUpAllFailures(url, 501, 1, map[string]string{header: gen(wanted)})
 
-			_, _, err := ReadRemoteFile(url, "")
+			_, _, err := ReadRemoteFile(context.Background(), url, "")
 			if err == nil {
 				t.Fatal("Expected request to fail with code 502")
 			}
@@ -186,7 +194,7 @@ func TestShouldUseExponentialBackoffIfNoRetryHeader(t *testing.T) {
 	retries := 5
 	_, clock := setUpAllFailures(url, 501, retries, nil)
 
-	_, _, err := ReadRemoteFile(url, "")
+	_, _, err := ReadRemoteFile(context.Background(), url, "")
 	if err == nil {
 		t.Fatal("Expected request to fail with code 501")
 	}
@@ -215,7 +223,7 @@ func TestDeadlineExceeded(t *testing.T) {
 	url := "http://bar"
 	setUpAllFailures(url, 500, 10, nil)
 
-	_, _, err := ReadRemoteFile(url, "")
+	_, _, err := ReadRemoteFile(context.Background(), url, "")
 	if err == nil {
 		t.Fatal("Expected request to fail with code 500")
 	}
@@ -236,7 +244,7 @@ func TestNoRetryOnPermanentError(t *testing.T) {
 	url := "http://xyz"
 	_, clock := setUpAllFailures(url, 404, 3, nil)
 
-	_, _, err := ReadRemoteFile(url, "")
+	_, _, err := ReadRemoteFile(context.Background(), url, "")
 	if err == nil {
 		t.Fatal("Expected request to fail with code 404")
 	}
@@ -251,3 +259,224 @@ func TestNoRetryOnPermanentError(t *testing.T) {
 		t.Fatalf("Expected no retries for permanent error, but got %d", clock.TimesSlept())
 	}
 }
+
+func TestDownloadHeaders(t *testing.T) {
+	cfg := config.Static(map[string]string{
+		HTTPHeadersEnv: "mirror.example.com=X-Api-Key: secret; other.example.com=Authorization:Bearer other;mirror.example.com=authorization:Bearer mirror",
+	})
+
+	tests := []struct {
+		url  string
+		auth string
+		want map[string]string
+	}{
+		{
+			url:  "https://mirror.example.com/bazel",
+			auth: "token abc",
+			want: map[string]string{"X-Api-Key": "secret", "Authorization": "Bearer mirror"},
+		},
+		{
+			url:  "https://other.example.com/bazel",
+			want: map[string]string{"Authorization": "Bearer other"},
+		},
+		{
+			url:  "https://github.com/fork/bazel",
+			auth: "token abc",
+			want: map[string]string{"Authorization": "token abc"},
+		},
+	}
+
+	for _, tc := range tests {
+		got, err := DownloadHeaders(context.Background(), tc.url, tc.auth, cfg)
+		if err != nil {
+			t.Fatalf("DownloadHeaders(%q): unexpected error %v", tc.url, err)
+		}
+		if !maps.Equal(got, tc.want) {
+			t.Errorf("DownloadHeaders(%q) = %v, want %v", tc.url, got, tc.want)
+		}
+	}
+}
+
+func TestDownloadHeadersInvalidConfig(t *testing.T) {
+	for _, value := range []string{"mirror.example.com", "mirror.example.com=X-Api-Key"} {
+		cfg := config.Static(map[string]string{HTTPHeadersEnv: value})
+		if _, err := DownloadHeaders(context.Background(), "https://mirror.example.com", "", cfg); err == nil {
+			t.Errorf("Expected DownloadHeaders() to fail for %s=%q", HTTPHeadersEnv, value)
+		}
+	}
+}
+
+// startRedirectServers starts a server that redirects every request to a server on another host, which serves a
+// binary. It returns the URL and host of the first server as well as the requests received by the second one.
+func startRedirectServers(t *testing.T) (string, string, *[]http.Header) {
+	var mu sync.Mutex
+	var received []http.Header
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		received = append(received, r.Header.Clone())
+		mu.Unlock()
+		fmt.Fprint(w, "the_binary")
+	}))
+	t.Cleanup(target.Close)
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Api-Key") == "" {
+			http.Error(w, "missing X-Api-Key", http.StatusUnauthorized)
+			return
+		}
+		http.Redirect(w, r, target.URL+r.URL.Path, http.StatusFound)
+	}))
+	t.Cleanup(origin.Close)
+	return origin.URL + "/bazel", strings.TrimPrefix(origin.URL, "http://"), &received
+}
+
+func TestDownloadBinaryDropsConfiguredHeadersOnRedirect(t *testing.T) {
+	url, host, received := startRedirectServers(t)
+	setUpRealTransport(t)
+	cfg := config.Static(map[string]string{HTTPHeadersEnv: host + "=X-Api-Key:secret"})
+
+	if _, err := DownloadBinary(context.Background(), url, t.TempDir(), "bazel", cfg); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if len(*received) == 0 {
+		t.Fatal("Expected the download to be redirected")
+	}
+	for _, h := range *received {
+		if got := h.Get("X-Api-Key"); got != "" {
+			t.Errorf("Expected X-Api-Key not to be sent to the redirect target, but got %q", got)
+		}
+	}
+}
+
+func TestDownloadBinaryRetriesTruncatedBody(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Length", "12")
+		if requests == 1 {
+			// Simulate a connection that drops in the middle of the body.
+			fmt.Fprint(w, "the_")
+			return
+		}
+		fmt.Fprint(w, "the_binary!!")
+	}))
+	defer server.Close()
+
+	setUpRealTransport(t)
+	MaxRetries = 2
+	clock := newFakeClock()
+	RetryClock = clock
+
+	path, err := DownloadBinary(context.Background(), server.URL, t.TempDir(), "bazel", config.Null())
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Could not read downloaded file: %v", err)
+	}
+	if string(content) != "the_binary!!" {
+		t.Errorf("Expected content %q, but got %q", "the_binary!!", content)
+	}
+	if requests != 2 || clock.TimesSlept() != 1 {
+		t.Errorf("Expected a single retry, but got %d requests and %d sleeps", requests, clock.TimesSlept())
+	}
+}
+
+func TestDownloadBinaryObeysRetryHeaders(t *testing.T) {
+	MaxRequestDuration = time.Hour
+	transport, clock := setUp()
+	url := "http://foo/bazel"
+	transport.AddResponse(url, 503, "", map[string]string{"Retry-After": "7"})
+	transport.AddResponse(url, 200, "the_binary", nil)
+
+	if _, err := DownloadBinary(context.Background(), url, t.TempDir(), "bazel", config.Null()); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if clock.TimesSlept() != 1 || clock.SleepPeriods[0] != 7*time.Second {
+		t.Errorf("Expected a single retry after 7s, but slept %v", clock.SleepPeriods)
+	}
+}
+
+func TestDownloadBinaryDetectsTruncatedBody(t *testing.T) {
+	MaxRequestDuration = time.Hour
+	url := "http://foo/bazel"
+	transport, _ := setUpAllFailures(url, 200, 1, nil)
+	transport.responses = map[string]*responseCollection{}
+	for i := 0; i < 2; i++ {
+		transport.AddResponse(url, 200, "short", map[string]string{"Content-Length": "100"})
+	}
+
+	_, err := DownloadBinary(context.Background(), url, t.TempDir(), "bazel", config.Null())
+	if err == nil {
+		t.Fatal("Expected download of truncated body to fail")
+	}
+	want := "could not download http://foo/bazel after 2 attempt(s): attempt 1: body is truncated: received 5 of 100 bytes; attempt 2: body is truncated: received 5 of 100 bytes"
+	if err.Error() != want {
+		t.Fatalf("Expected error %q, but got %q", want, err.Error())
+	}
+}
+
+func TestDownloadBinaryNoRetryOnPermanentError(t *testing.T) {
+	url := "http://foo/bazel"
+	_, clock := setUpAllFailures(url, 404, 3, nil)
+
+	_, err := DownloadBinary(context.Background(), url, t.TempDir(), "bazel", config.Null())
+	if err == nil {
+		t.Fatal("Expected download to fail with code 404")
+	}
+	want := "could not download http://foo/bazel after 1 attempt(s): attempt 1: HTTP 404"
+	if err.Error() != want {
+		t.Fatalf("Expected error %q, but got %q", want, err.Error())
+	}
+	if clock.TimesSlept() > 0 {
+		t.Fatalf("Expected no retries for permanent error, but got %d", clock.TimesSlept())
+	}
+}
+
+func TestDownloadBinaryNotFound(t *testing.T) {
+	MaxRequestDuration = time.Hour
+	for _, tc := range []struct {
+		status       int
+		wantNotFound bool
+	}{
+		{status: 404, wantNotFound: true},
+		{status: 410, wantNotFound: true},
+		{status: 403, wantNotFound: false},
+		{status: 503, wantNotFound: false},
+	} {
+		url := "http://foo/bazel"
+		setUpAllFailures(url, tc.status, 1, nil)
+		_, err := DownloadBinary(context.Background(), url, t.TempDir(), "bazel", config.Null())
+		if err == nil {
+			t.Fatalf("Expected download to fail with code %d", tc.status)
+		}
+		if got := errors.Is(err, ErrNotFound); got != tc.wantNotFound {
+			t.Errorf("Expected errors.Is(ErrNotFound) to be %v for HTTP %d, but got %v", tc.wantNotFound, tc.status, got)
+		}
+	}
+}
+
+func TestDownloadBinaryDeadlineExceeded(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		w.WriteHeader(503)
+	}))
+	defer server.Close()
+
+	setUpRealTransport(t)
+	MaxRetries = 100
+	MaxRequestDuration = time.Hour
+	RetryClock = &realClock{}
+	oldDuration := MaxDownloadDuration
+	MaxDownloadDuration = 200 * time.Millisecond
+	t.Cleanup(func() { MaxDownloadDuration = oldDuration })
+
+	_, err := DownloadBinary(context.Background(), server.URL, t.TempDir(), "bazel", config.Null())
+	if err == nil {
+		t.Fatal("Expected download to fail")
+	}
+	want := fmt.Sprintf("download of %s did not finish within 200ms", server.URL)
+	if !strings.HasPrefix(err.Error(), want) {
+		t.Fatalf("Expected error starting with %q, but got %q", want, err.Error())
+	}
+}
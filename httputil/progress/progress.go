@@ -1,4 +1,4 @@
-// Package progress makes it possible to display download progress.
+// Package progress makes it possible to display the progress of downloads and other slow operations.
 package progress
 
 import (
@@ -6,120 +6,320 @@ import (
 	"io"
 	"os"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"golang.org/x/term"
 
 	"github.com/bazelbuild/bazelisk/config"
 )
 
-// Progress shows a download progress bar.
-type progress struct {
-	header      string
-	total       int64
-	current     int64
-	lastMessage string
+const (
+	// ShowProgressEnv is the name of the config value that controls how progress is displayed.
+	// Valid values are "auto" (the default), "yes", "no" and "plain", as well as the usual synonyms of yes and no.
+	ShowProgressEnv = "BAZELISK_SHOW_PROGRESS"
+)
+
+var (
+	// Output is where progress is written to. It's stderr so that progress output doesn't mix with Bazel's stdout.
+	Output io.Writer = os.Stderr
+	// RedrawInterval limits how often the terminal reporter redraws the progress bar.
+	RedrawInterval = 100 * time.Millisecond
+	// PlainInterval specifies how often the plain reporter prints a line.
+	PlainInterval = 5 * time.Second
+
+	// Default reports the progress of operations that don't have access to the config, such as listing the available
+	// Bazel versions. It doesn't display anything until Configure is called.
+	Default = Discard
+)
+
+// Unit describes what the amounts of an operation count.
+type Unit string
+
+const (
+	// Bytes are formatted with a suitable size unit, e.g. "1.5 MB", and also result in a speed and an ETA.
+	Bytes Unit = "bytes"
+	// Pages count the requests of a paginated listing.
+	Pages Unit = "pages"
+)
+
+// Reporter displays the progress of an operation, such as a download.
+// Implementations are safe for concurrent use.
+type Reporter interface {
+	// Start begins a new operation with the given description. total is the expected amount in the given unit,
+	// or a non-positive value if it's unknown.
+	Start(header string, total int64, unit Unit)
+	// Update reports the amount that has been processed so far.
+	Update(current int64)
+	// Finish completes the operation. The final progress of byte operations remains visible, whereas operations
+	// with other units are considered intermediate steps that only need to be shown while they're running.
+	Finish()
 }
 
-func showProgress(config config.Config) bool {
-	// If stdout is a terminal, don't show progress.
-	if !term.IsTerminal(int(os.Stdout.Fd())) {
-		return false
+type mode int
+
+const (
+	modeAuto mode = iota
+	modeYes
+	modeNo
+	modePlain
+)
+
+func parseMode(config config.Config) (mode, error) {
+	value := config.Get(ShowProgressEnv)
+	switch strings.ToLower(value) {
+	case "", "auto":
+		return modeAuto, nil
+	case "yes", "y", "true", "1":
+		return modeYes, nil
+	case "no", "n", "false", "0":
+		return modeNo, nil
+	case "plain":
+		return modePlain, nil
 	}
+	return modeAuto, fmt.Errorf("invalid value %q for %s: must be one of auto, yes, no or plain", value, ShowProgressEnv)
+}
 
-	// Check the config variable.
-	showProgress := config.Get("BAZELISK_SHOW_PROGRESS")
-	if len(showProgress) == 0 {
-		// Default to showing progress
-		return true
+// NewReporter returns the reporter that the config asks for. By default, progress is only shown if stderr is a terminal.
+// If progress is enabled explicitly, it's shown as plain lines when stderr isn't a terminal (e.g. in CI logs).
+func NewReporter(config config.Config) (Reporter, error) {
+	m, err := parseMode(config)
+	if err != nil {
+		return nil, err
 	}
-	switch strings.ToLower(showProgress) {
-	case "":
-		return true // Default to on
-	case "yes":
-		return true
-	case "y":
-		return true
-	case "true":
-		return true
-	case "1":
-		return true
-	case "no":
-		return false
-	case "n":
-		return false
-	case "false":
-		return false
-	case "0":
-		return false
+	isTerminal := term.IsTerminal(int(os.Stderr.Fd()))
+	switch {
+	case m == modeNo, m == modeAuto && !isTerminal:
+		return Discard, nil
+	case m == modePlain, m == modeYes && !isTerminal:
+		return NewPlainReporter(Output), nil
 	}
-	// TODO: default: error
-
-	return true
+	return NewTerminalReporter(Output, terminalWidth), nil
 }
 
-// Writer creates an io.Writer to print the progress.
-func Writer(w io.Writer, header string, total int64, config config.Config) io.Writer {
-	if !showProgress(config) {
-		return w
+// Configure sets Default to the reporter that the config asks for.
+func Configure(config config.Config) error {
+	reporter, err := NewReporter(config)
+	if err != nil {
+		return err
 	}
-	prog := &progress{
-		header: header,
-		total:  total,
+	Default = reporter
+	return nil
+}
+
+func terminalWidth() int {
+	width, _, err := term.GetSize(int(os.Stderr.Fd()))
+	if err != nil || width <= 0 {
+		return 80
 	}
-	out := io.MultiWriter(w, prog)
-	return out
+	return width
+}
+
+// Writer returns an io.Writer that writes to w and reports the number of written bytes to the reporter.
+// It's safe for concurrent use if w is, which allows multiple goroutines to report progress for the same operation.
+func Writer(w io.Writer, reporter Reporter) io.Writer {
+	return &countingWriter{w: w, reporter: reporter}
+}
+
+type countingWriter struct {
+	w        io.Writer
+	reporter Reporter
+	written  atomic.Int64
+}
+
+func (cw *countingWriter) Write(buf []byte) (int, error) {
+	n, err := cw.w.Write(buf)
+	cw.reporter.Update(cw.written.Add(int64(n)))
+	return n, err
 }
 
-// Finish writes final output after the progress bar is complete. 
-func Finish(config config.Config) {
-	if showProgress(config) {
-		// Add a newline after the progress bar
-		fmt.Println()
+// Discard is a Reporter that doesn't display anything.
+var Discard Reporter = discard{}
+
+type discard struct{}
+
+func (discard) Start(string, int64, Unit) {}
+func (discard) Update(int64)              {}
+func (discard) Finish()                   {}
+
+// state keeps track of an operation and computes its speed.
+type state struct {
+	header  string
+	total   int64
+	current int64
+	unit    Unit
+	started time.Time
+}
+
+func (s *state) message(now time.Time) string {
+	var sb strings.Builder
+	sb.WriteString(s.header)
+	sb.WriteString(": ")
+	if s.unit != Bytes {
+		fmt.Fprintf(&sb, "%d", s.current)
+		if s.total > 0 {
+			fmt.Fprintf(&sb, " out of %d", s.total)
+		}
+		fmt.Fprintf(&sb, " %s", s.unit)
+		if s.total > 0 {
+			fmt.Fprintf(&sb, " (%s)", formatPercentage(s.current, s.total))
+		}
+		return sb.String()
+	}
+	sb.WriteString(formatSize(s.current))
+	if s.total > 0 {
+		fmt.Fprintf(&sb, " out of %s (%s)", formatSize(s.total), formatPercentage(s.current, s.total))
+	}
+	elapsed := now.Sub(s.started)
+	if elapsed < time.Second || s.current == 0 {
+		return sb.String()
 	}
+	speed := float64(s.current) / elapsed.Seconds()
+	fmt.Fprintf(&sb, ", %s/s", formatSize(int64(speed)))
+	if s.total > s.current {
+		eta := time.Duration(float64(s.total-s.current) / speed * float64(time.Second))
+		fmt.Fprintf(&sb, ", ETA %s", formatDuration(eta))
+	}
+	return sb.String()
 }
 
-func (p *progress) Write(buf []byte) (int, error) {
-	l := len(buf)
-	p.current += int64(l)
-	p.ShowProgress()
-	return l, nil
+// terminalReporter redraws a single line on a terminal.
+type terminalReporter struct {
+	out   io.Writer
+	width func() int
+	now   func() time.Time
+
+	mu         sync.Mutex
+	state      state
+	lastDraw   time.Time
+	lastLength int
 }
 
-// Writes the current download progress to stdout.
-func (p *progress) ShowProgress() {
-	var message string
+// NewTerminalReporter returns a Reporter that continuously redraws a single line with the progress, the speed and
+// the estimated remaining time. The width function returns the width of the terminal, so that the line never wraps.
+func NewTerminalReporter(out io.Writer, width func() int) Reporter {
+	return &terminalReporter{out: out, width: width, now: time.Now}
+}
 
-	if p.total > 0 {
-		message = fmt.Sprintf("%s: %s out of %s (%s)",
-			p.header,
-			formatMb(p.current),
-			formatMb(p.total),
-			formatPercentage(p.current, p.total))
-	} else {
-		message = fmt.Sprintf("%s: %s",
-			p.header,
-			formatMb(p.current))
+func (tr *terminalReporter) Start(header string, total int64, unit Unit) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	tr.state = state{header: header, total: total, unit: unit, started: tr.now()}
+	tr.lastDraw = time.Time{}
+	tr.lastLength = 0
+	tr.draw()
+}
+
+func (tr *terminalReporter) Update(current int64) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	tr.state.current = current
+	if tr.now().Sub(tr.lastDraw) >= RedrawInterval || current == tr.state.total {
+		tr.draw()
 	}
+}
 
-	if message == p.lastMessage {
+func (tr *terminalReporter) Finish() {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	if tr.state.unit != Bytes {
+		fmt.Fprintf(tr.out, "\r%s\r", strings.Repeat(" ", tr.lastLength))
+		tr.lastLength = 0
 		return
 	}
+	tr.draw()
+	fmt.Fprintln(tr.out)
+}
+
+func (tr *terminalReporter) draw() {
+	now := tr.now()
+	message := tr.state.message(now)
+	// Leave the last column empty, since some terminals wrap as soon as it's written.
+	if maxLength := tr.width() - 1; maxLength > 0 && len(message) > maxLength {
+		message = message[:maxLength]
+	}
+	padding := ""
+	if len(message) < tr.lastLength {
+		// Overwrite the remainder of the previous, longer message.
+		padding = strings.Repeat(" ", tr.lastLength-len(message))
+	}
+	fmt.Fprintf(tr.out, "\r%s%s", message, padding)
+	tr.lastDraw = now
+	tr.lastLength = len(message)
+}
+
+// plainReporter prints a new line at regular intervals, which is better suited for logs than redrawing a line.
+type plainReporter struct {
+	out io.Writer
+	now func() time.Time
+
+	mu        sync.Mutex
+	state     state
+	lastPrint time.Time
+}
 
-	// Clear the line.
-	fmt.Printf("\r%s", strings.Repeat(" ", 39))
+// NewPlainReporter returns a Reporter that prints the progress as a separate line every PlainInterval.
+func NewPlainReporter(out io.Writer) Reporter {
+	return &plainReporter{out: out, now: time.Now}
+}
+
+func (pr *plainReporter) Start(header string, total int64, unit Unit) {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+	pr.state = state{header: header, total: total, unit: unit, started: pr.now()}
+	pr.lastPrint = pr.state.started
+}
 
-	// Show a message, don't add a newline
-	fmt.Printf("\r%s", message)
-	p.lastMessage = message
+func (pr *plainReporter) Update(current int64) {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+	pr.state.current = current
+	if now := pr.now(); now.Sub(pr.lastPrint) >= PlainInterval {
+		fmt.Fprintln(pr.out, pr.state.message(now))
+		pr.lastPrint = now
+	}
+}
+
+func (pr *plainReporter) Finish() {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+	if pr.state.unit != Bytes {
+		// Only summarize intermediate steps that were slow enough to print progress lines.
+		if pr.lastPrint.Equal(pr.state.started) {
+			return
+		}
+		fmt.Fprintf(pr.out, "%s: %d %s in %s\n", pr.state.header, pr.state.current, pr.state.unit, formatDuration(pr.now().Sub(pr.state.started)))
+		return
+	}
+	elapsed := pr.now().Sub(pr.state.started)
+	fmt.Fprintf(pr.out, "%s: %s in %s\n", pr.state.header, formatSize(pr.state.current), formatDuration(elapsed))
 }
 
-func formatMb(size int64) string {
-	// TODO: Use units other than MB
-	inMb := size / (1024 * 1024)
-	return fmt.Sprintf("%d MB", inMb)
+var units = []string{"KB", "MB", "GB", "TB"}
+
+// formatSize formats the number of bytes with the largest unit that keeps the value at or above 1.
+func formatSize(size int64) string {
+	if size < 1024 {
+		return fmt.Sprintf("%d B", size)
+	}
+	value := float64(size) / 1024
+	unit := 0
+	for value >= 1024 && unit < len(units)-1 {
+		value /= 1024
+		unit++
+	}
+	return fmt.Sprintf("%.1f %s", value, units[unit])
 }
 
 func formatPercentage(current, size int64) string {
 	percentage := current * 100 / size
 	return fmt.Sprintf("%d%%", percentage)
 }
+
+func formatDuration(d time.Duration) string {
+	if d < time.Second {
+		return d.Round(time.Millisecond).String()
+	}
+	return d.Round(time.Second).String()
+}
@@ -1,29 +1,37 @@
 package progress
 
 import (
+	"bytes"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/bazelbuild/bazelisk/config"
 )
 
-func TestFormatMb(t *testing.T) {
+func TestFormatSize(t *testing.T) {
 	type test struct {
 		input int64
 		want  string
 	}
 	tests := []test{
-		{input: 48*1024*1024 + 512, want: "48 MB"},
-		{input: 58538527, want: "55 MB"},
-		{input: 0, want: "0 MB"},
-		{input: 48*1024*1024 - 1, want: "47 MB"},
-		{input: 48 * 1024 * 1024, want: "48 MB"},
-		{input: 48 * 1024 * 1024 * 1024, want: "49152 MB"},
+		{input: 0, want: "0 B"},
+		{input: 1023, want: "1023 B"},
+		{input: 1024, want: "1.0 KB"},
+		{input: 1536, want: "1.5 KB"},
+		{input: 48*1024*1024 + 512, want: "48.0 MB"},
+		{input: 58538527, want: "55.8 MB"},
+		{input: 48*1024*1024 - 1, want: "48.0 MB"},
+		{input: 48 * 1024 * 1024 * 1024, want: "48.0 GB"},
 	}
 
 	for _, tc := range tests {
 		name := tc.want
 		t.Run(name, func(t *testing.T) {
-			got := formatMb(tc.input)
+			got := formatSize(tc.input)
 			if got != tc.want {
-				t.Errorf("formatMb() = %q, want %q", got ,tc.want)
+				t.Errorf("formatSize() = %q, want %q", got, tc.want)
 			}
 		})
 	}
@@ -50,3 +58,190 @@ func TestFormatPercentage(t *testing.T) {
 		})
 	}
 }
+
+func TestParseMode(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    mode
+		wantErr bool
+	}{
+		{value: "", want: modeAuto},
+		{value: "auto", want: modeAuto},
+		{value: "YES", want: modeYes},
+		{value: "1", want: modeYes},
+		{value: "n", want: modeNo},
+		{value: "false", want: modeNo},
+		{value: "plain", want: modePlain},
+		{value: "maybe", wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.value, func(t *testing.T) {
+			got, err := parseMode(config.Static(map[string]string{ShowProgressEnv: tc.value}))
+			if tc.wantErr {
+				if err == nil || !strings.Contains(err.Error(), ShowProgressEnv) {
+					t.Fatalf("Expected error about %s, but got %v", ShowProgressEnv, err)
+				}
+				return
+			}
+			if err != nil || got != tc.want {
+				t.Fatalf("parseMode() = %v, %v, want %v", got, err, tc.want)
+			}
+		})
+	}
+}
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (fc *fakeClock) Now() time.Time {
+	return fc.now
+}
+
+func (fc *fakeClock) Advance(d time.Duration) {
+	fc.now = fc.now.Add(d)
+}
+
+func TestTerminalReporter(t *testing.T) {
+	var out bytes.Buffer
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	reporter := &terminalReporter{out: &out, width: func() int { return 200 }, now: clock.Now}
+
+	reporter.Start("Downloading", 4*1024*1024, Bytes)
+	clock.Advance(2 * time.Second)
+	reporter.Update(1024 * 1024)
+	// Updates within RedrawInterval are skipped.
+	reporter.Update(1024*1024 + 1)
+	clock.Advance(2 * time.Second)
+	reporter.Update(4 * 1024 * 1024)
+	reporter.Finish()
+
+	want := "\rDownloading: 0 B out of 4.0 MB (0%)" +
+		"\rDownloading: 1.0 MB out of 4.0 MB (25%), 512.0 KB/s, ETA 6s" +
+		"\rDownloading: 4.0 MB out of 4.0 MB (100%), 1.0 MB/s         " +
+		"\rDownloading: 4.0 MB out of 4.0 MB (100%), 1.0 MB/s\n"
+	if got := out.String(); got != want {
+		t.Errorf("Expected output %q, but got %q", want, got)
+	}
+}
+
+func TestTerminalReporterTruncatesToWidth(t *testing.T) {
+	var out bytes.Buffer
+	reporter := NewTerminalReporter(&out, func() int { return 20 })
+	reporter.Start("Downloading something big", -1, Bytes)
+
+	if got, want := out.String(), "\rDownloading somethi"; got != want {
+		t.Errorf("Expected output %q, but got %q", want, got)
+	}
+}
+
+func TestPlainReporter(t *testing.T) {
+	var out bytes.Buffer
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	reporter := &plainReporter{out: &out, now: clock.Now}
+
+	reporter.Start("Downloading", 3000, Bytes)
+	clock.Advance(time.Second)
+	reporter.Update(1000)
+	clock.Advance(PlainInterval)
+	reporter.Update(2000)
+	clock.Advance(time.Second)
+	reporter.Update(3000)
+	reporter.Finish()
+
+	want := "Downloading: 2.0 KB out of 2.9 KB (66%), 333 B/s, ETA 3s\n" +
+		"Downloading: 2.9 KB in 7s\n"
+	if got := out.String(); got != want {
+		t.Errorf("Expected output %q, but got %q", want, got)
+	}
+}
+
+func TestTerminalReporterClearsIntermediateSteps(t *testing.T) {
+	var out bytes.Buffer
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	reporter := &terminalReporter{out: &out, width: func() int { return 200 }, now: clock.Now}
+
+	reporter.Start("Listing Bazel versions", -1, Pages)
+	clock.Advance(time.Second)
+	reporter.Update(12)
+	reporter.Finish()
+
+	want := "\rListing Bazel versions: 0 pages" +
+		"\rListing Bazel versions: 12 pages" +
+		"\r" + strings.Repeat(" ", len("Listing Bazel versions: 12 pages")) + "\r"
+	if got := out.String(); got != want {
+		t.Errorf("Expected output %q, but got %q", want, got)
+	}
+}
+
+func TestPlainReporterIntermediateSteps(t *testing.T) {
+	var out bytes.Buffer
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	reporter := &plainReporter{out: &out, now: clock.Now}
+
+	// Fast steps don't print anything.
+	reporter.Start("Listing Bazel versions", -1, Pages)
+	clock.Advance(time.Second)
+	reporter.Update(1)
+	reporter.Finish()
+	if got := out.String(); got != "" {
+		t.Errorf("Expected no output for a fast step, but got %q", got)
+	}
+
+	reporter.Start("Verifying", 4, Pages)
+	clock.Advance(PlainInterval)
+	reporter.Update(3)
+	clock.Advance(time.Second)
+	reporter.Update(4)
+	reporter.Finish()
+
+	want := "Verifying: 3 out of 4 pages (75%)\n" +
+		"Verifying: 4 pages in 6s\n"
+	if got := out.String(); got != want {
+		t.Errorf("Expected output %q, but got %q", want, got)
+	}
+}
+
+type recordingReporter struct {
+	mu     sync.Mutex
+	latest int64
+}
+
+func (rr *recordingReporter) Start(string, int64, Unit) {}
+func (rr *recordingReporter) Finish()                   {}
+
+func (rr *recordingReporter) Update(current int64) {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	if current > rr.latest {
+		rr.latest = current
+	}
+}
+
+func TestWriterCountsConcurrentWrites(t *testing.T) {
+	reporter := &recordingReporter{}
+	w := Writer(discardWriter{}, reporter)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				w.Write(make([]byte, 10))
+			}
+		}()
+	}
+	wg.Wait()
+
+	if reporter.latest != 10000 {
+		t.Errorf("Expected 10000 bytes to be reported, but got %d", reporter.latest)
+	}
+}
+
+type discardWriter struct{}
+
+func (discardWriter) Write(p []byte) (int, error) {
+	return len(p), nil
+}
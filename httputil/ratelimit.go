@@ -0,0 +1,70 @@
+package httputil
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// RateLimitWaitEnv is the name of the config value that overrides MaxRateLimitWait, e.g. "5m".
+	RateLimitWaitEnv = "BAZELISK_RATE_LIMIT_WAIT"
+)
+
+var (
+	// MaxRateLimitWait is the longest period that Bazelisk waits for an exhausted rate limit (e.g. of the GitHub API) to reset.
+	// Requests fail immediately if the rate limit resets later than that.
+	MaxRateLimitWait = time.Minute
+
+	// logVerbosity is the verbosity from the config that was passed to ConfigureTransport.
+	// It's needed for functions that don't have access to the config.
+	logVerbosity = 0
+)
+
+// rateLimitReset checks whether the request was rejected because the rate limit has been exhausted,
+// as indicated by the X-RateLimit-* headers that GitHub sends. If so, it returns the time until the limit resets.
+func rateLimitReset(res *http.Response) (time.Duration, bool) {
+	if res == nil || (res.StatusCode != http.StatusForbidden && res.StatusCode != http.StatusTooManyRequests) {
+		return 0, false
+	}
+	if res.Header.Get("X-RateLimit-Remaining") != "0" {
+		return 0, false
+	}
+	reset, err := strconv.ParseInt(res.Header.Get("X-RateLimit-Reset"), 10, 64)
+	if err != nil {
+		// We don't know when the limit resets, so we cannot wait for it.
+		return time.Duration(1<<63 - 1), true
+	}
+	wait := time.Unix(reset, 0).Sub(RetryClock.Now())
+	if wait < 0 {
+		wait = 0
+	}
+	return wait, true
+}
+
+// rateLimitError returns the error for requests that cannot be retried within MaxRateLimitWait.
+func rateLimitError(url string, wait time.Duration) error {
+	when := "at an unknown time"
+	if wait < 24*time.Hour {
+		when = fmt.Sprintf("in %v", wait.Round(time.Second))
+	}
+	return fmt.Errorf("rate limit for %s exceeded, it resets %s (consider setting BAZELISK_GITHUB_TOKEN for requests to GitHub, or increasing %s)", url, when, RateLimitWaitEnv)
+}
+
+// logRateLimit logs the remaining quota if the response contains rate limit headers and the verbosity is at least 1.
+func logRateLimit(url string, res *http.Response) {
+	if logVerbosity < 1 || res == nil {
+		return
+	}
+	remaining := res.Header.Get("X-RateLimit-Remaining")
+	if remaining == "" {
+		return
+	}
+	message := fmt.Sprintf("Rate limit for %s: %s of %s requests remaining", url, remaining, res.Header.Get("X-RateLimit-Limit"))
+	if reset, err := strconv.ParseInt(res.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+		message += fmt.Sprintf(", resets at %s", time.Unix(reset, 0).Format(time.RFC3339))
+	}
+	log.Print(message)
+}
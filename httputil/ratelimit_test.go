@@ -0,0 +1,106 @@
+package httputil
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bazelbuild/bazelisk/config"
+)
+
+func rateLimitHeaders(reset time.Time) map[string]string {
+	return map[string]string{
+		"X-RateLimit-Limit":     "60",
+		"X-RateLimit-Remaining": "0",
+		"X-RateLimit-Reset":     strconv.FormatInt(reset.Unix(), 10),
+	}
+}
+
+func TestRateLimitWaitsForReset(t *testing.T) {
+	transport, clock := setUp()
+	url := "https://api.github.com/repos/foo/bazel/releases"
+	transport.AddResponse(url, 403, "", rateLimitHeaders(seed.Add(20*time.Second)))
+	transport.AddResponse(url, 200, "[]", nil)
+
+	body, _, err := ReadRemoteFile(context.Background(), url, "")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if string(body) != "[]" {
+		t.Errorf("Expected body %q, but got %q", "[]", body)
+	}
+	if clock.TimesSlept() != 1 || clock.SleepPeriods[0] > 20*time.Second || clock.SleepPeriods[0] < 19*time.Second {
+		t.Errorf("Expected to wait about 20s for the rate limit to reset, but slept %v", clock.SleepPeriods)
+	}
+}
+
+func TestRateLimitResetsTooLate(t *testing.T) {
+	transport, clock := setUp()
+	url := "https://api.github.com/repos/foo/bazel/releases"
+	transport.AddResponse(url, 403, "", rateLimitHeaders(seed.Add(time.Hour)))
+
+	_, _, err := ReadRemoteFile(context.Background(), url, "")
+	if err == nil || !strings.Contains(err.Error(), "rate limit for "+url+" exceeded") {
+		t.Fatalf("Expected rate limit error, but got %v", err)
+	}
+	if clock.TimesSlept() > 0 {
+		t.Errorf("Expected no waiting, but slept %v", clock.SleepPeriods)
+	}
+}
+
+func TestRateLimitOnlyWaitsOnce(t *testing.T) {
+	transport, clock := setUp()
+	url := "https://api.github.com/repos/foo/bazel/releases"
+	for i := 0; i < 3; i++ {
+		transport.AddResponse(url, 429, "", rateLimitHeaders(seed.Add(10*time.Second)))
+	}
+
+	_, _, err := ReadRemoteFile(context.Background(), url, "")
+	if err == nil || !strings.Contains(err.Error(), "rate limit") {
+		t.Fatalf("Expected rate limit error, but got %v", err)
+	}
+	if clock.TimesSlept() != 1 {
+		t.Errorf("Expected to wait once, but slept %v", clock.SleepPeriods)
+	}
+}
+
+func TestForbiddenWithoutRateLimitIsNotRetried(t *testing.T) {
+	transport, clock := setUp()
+	url := "https://api.github.com/repos/foo/bazel/releases"
+	transport.AddResponse(url, 403, "", map[string]string{"X-RateLimit-Remaining": "42"})
+
+	_, _, err := ReadRemoteFile(context.Background(), url, "")
+	if err == nil || !strings.Contains(err.Error(), "403") {
+		t.Fatalf("Expected error with status 403, but got %v", err)
+	}
+	if clock.TimesSlept() > 0 {
+		t.Errorf("Expected no retries, but slept %v", clock.SleepPeriods)
+	}
+}
+
+func TestDownloadBinaryWaitsForRateLimit(t *testing.T) {
+	transport, clock := setUp()
+	url := "https://api.github.com/repos/foo/bazel/releases/assets/1"
+	transport.AddResponse(url, 403, "", rateLimitHeaders(seed.Add(30*time.Second)))
+	transport.AddResponse(url, 200, "the_binary", nil)
+
+	if _, err := DownloadBinary(context.Background(), url, t.TempDir(), "bazel", config.Null()); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if clock.TimesSlept() != 1 || clock.SleepPeriods[0] < 29*time.Second {
+		t.Errorf("Expected to wait about 30s for the rate limit to reset, but slept %v", clock.SleepPeriods)
+	}
+}
+
+func TestDownloadBinaryRateLimitResetsTooLate(t *testing.T) {
+	transport, _ := setUp()
+	url := "https://api.github.com/repos/foo/bazel/releases/assets/1"
+	transport.AddResponse(url, 403, "", rateLimitHeaders(seed.Add(time.Hour)))
+
+	_, err := DownloadBinary(context.Background(), url, t.TempDir(), "bazel", config.Null())
+	if err == nil || !strings.Contains(err.Error(), "consider setting BAZELISK_GITHUB_TOKEN") {
+		t.Fatalf("Expected rate limit error, but got %v", err)
+	}
+}
@@ -85,12 +85,10 @@ func DetermineOperatingSystem() (string, error) {
 }
 
 // DetermineBazelFilename returns the correct file name of a local Bazel binary.
-func DetermineBazelFilename(version string, includeSuffix bool, config config.Config) (string, error) {
+func DetermineBazelFilename(version string, includeSuffix bool, cfg config.Config) (string, error) {
 	flavor := "bazel"
 
-	bazeliskNojdk := config.Get("BAZELISK_NOJDK")
-
-	if len(bazeliskNojdk) != 0 && bazeliskNojdk != "0" {
+	if config.IsEnabled(cfg, "BAZELISK_NOJDK") {
 		flavor = "bazel_nojdk"
 	}
 
@@ -4,9 +4,12 @@
 package repositories
 
 import (
+	"context"
+	"crypto/sha256"
 	"encoding/json"
 	"fmt"
 	"log"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
@@ -14,8 +17,10 @@ import (
 	"github.com/bazelbuild/bazelisk/config"
 	"github.com/bazelbuild/bazelisk/core"
 	"github.com/bazelbuild/bazelisk/httputil"
+	"github.com/bazelbuild/bazelisk/httputil/progress"
 	"github.com/bazelbuild/bazelisk/platforms"
 	"github.com/bazelbuild/bazelisk/versions"
+	"github.com/hashicorp/go-version"
 )
 
 const (
@@ -31,27 +36,33 @@ type GCSRepo struct{}
 // LTSRepo
 
 // GetLTSVersions returns the versions of all available Bazel releases in this repository that match the given filter.
-func (gcs *GCSRepo) GetLTSVersions(bazeliskHome string, opts *core.FilterOpts) ([]string, error) {
-	history, err := getVersionHistoryFromGCS()
+func (gcs *GCSRepo) GetLTSVersions(ctx context.Context, bazeliskHome string, opts *core.FilterOpts) ([]string, error) {
+	listing := startListing()
+	defer listing.finish()
+	history, err := getVersionHistoryFromGCS(ctx, bazeliskHome, listing)
 	if err != nil {
 		return []string{}, err
 	}
-	matches, err := gcs.matchingVersions(history, opts)
+	matches, err := gcs.matchingVersions(ctx, bazeliskHome, history, opts, listing)
 	if err != nil {
 		return []string{}, err
 	}
 	if len(matches) == 0 {
 		var suffix string
-		if opts.Track > 0 {
+		if opts.HasMinorTrack {
+			suffix = fmt.Sprintf(" for track %d.%d", opts.Track, opts.MinorTrack)
+		} else if opts.Track > 0 {
 			suffix = fmt.Sprintf(" for track %d", opts.Track)
+		} else if opts.Constraints != nil {
+			suffix = fmt.Sprintf(" matching %s", opts.Constraints)
 		}
-		return []string{}, fmt.Errorf("could not find any LTS Bazel binaries%s", suffix)
+		return []string{}, &core.VersionNotFoundError{Message: fmt.Sprintf("could not find any LTS Bazel binaries%s", suffix)}
 	}
 	return matches, nil
 }
 
-func getVersionHistoryFromGCS() ([]string, error) {
-	prefixes, err := listDirectoriesInBucket("")
+func getVersionHistoryFromGCS(ctx context.Context, bazeliskHome string, listing *listingProgress) ([]string, error) {
+	prefixes, err := listDirectoriesInBucket(ctx, bazeliskHome, "", listing)
 	if err != nil {
 		return []string{}, fmt.Errorf("could not list Bazel versions in GCS bucket: %v", err)
 	}
@@ -61,7 +72,10 @@ func getVersionHistoryFromGCS() ([]string, error) {
 	return sorted, nil
 }
 
-func listDirectoriesInBucket(prefix string) ([]string, error) {
+// listDirectoriesInBucket returns the directories in the Bazel bucket that start with the given prefix.
+// All pages of the listing are cached under bazeliskHome, but always revalidated with a conditional request, so that
+// new releases and release candidates show up immediately.
+func listDirectoriesInBucket(ctx context.Context, bazeliskHome, prefix string, listing *listingProgress) ([]string, error) {
 	baseURL := "https://www.googleapis.com/storage/v1/b/bazel/o?delimiter=/"
 	if prefix != "" {
 		baseURL = fmt.Sprintf("%s&prefix=%s", baseURL, prefix)
@@ -69,7 +83,7 @@ func listDirectoriesInBucket(prefix string) ([]string, error) {
 
 	var prefixes []string
 	var nextPageToken = ""
-	for {
+	for page := 0; ; page++ {
 		var url = baseURL
 		if nextPageToken != "" {
 			url = fmt.Sprintf("%s&pageToken=%s", baseURL, nextPageToken)
@@ -82,8 +96,8 @@ func listDirectoriesInBucket(prefix string) ([]string, error) {
 		// https://github.com/bazelbuild/continuous-integration/issues/1627
 		waitTime := 100 * time.Microsecond
 		for attempt := 0; attempt < 5; attempt++ {
-			content, _, err = httputil.ReadRemoteFile(url, "")
-			if err == nil {
+			content, err = httputil.ReadCachedRemoteFile(ctx, bazeliskHome, url, gcsCacheFilename(prefix, page), 0)
+			if err == nil || ctx.Err() != nil {
 				break
 			}
 			time.Sleep(waitTime)
@@ -100,6 +114,7 @@ func listDirectoriesInBucket(prefix string) ([]string, error) {
 		}
 
 		prefixes = append(prefixes, response.Prefixes...)
+		listing.page()
 
 		if response.NextPageToken == "" {
 			break
@@ -109,6 +124,32 @@ func listDirectoriesInBucket(prefix string) ([]string, error) {
 	return prefixes, nil
 }
 
+// listingProgress reports the number of listed pages across all requests that are necessary to find a version.
+type listingProgress struct {
+	pages int64
+}
+
+func startListing() *listingProgress {
+	progress.Default.Start("Listing Bazel versions", -1, progress.Pages)
+	return &listingProgress{}
+}
+
+func (lp *listingProgress) page() {
+	lp.pages++
+	progress.Default.Update(lp.pages)
+}
+
+func (lp *listingProgress) finish() {
+	progress.Default.Finish()
+}
+
+// gcsCacheFilename returns the name of the file that caches the given page of the GCS listing for the prefix.
+// Page tokens change whenever the bucket changes, so the page number is used instead to bound the number of files.
+// Prefixes may contain arbitrary characters, hence the hash.
+func gcsCacheFilename(prefix string, page int) string {
+	return filepath.Join("gcs", fmt.Sprintf("%x-%d.json", sha256.Sum256([]byte(prefix)), page))
+}
+
 // GcsListResponse represents the result of listing the contents of a GCS bucket.
 // Public for testing
 type GcsListResponse struct {
@@ -131,13 +172,13 @@ func getVersionsFromGCSPrefixes(versions []string) []string {
 	return result
 }
 
-func (gcs *GCSRepo) matchingVersions(history []string, opts *core.FilterOpts) ([]string, error) {
+func (gcs *GCSRepo) matchingVersions(ctx context.Context, bazeliskHome string, history []string, opts *core.FilterOpts, listing *listingProgress) ([]string, error) {
 	descendingMatches := make([]string, 0)
 	// history is a list of base versions in ascending order (i.e. X.Y.Z, no rolling releases or candidates).
 	for hpos := len(history) - 1; hpos >= 0; hpos-- {
 		baseVersion := history[hpos]
-		if opts.Track > 0 {
-			track, err := getTrack(baseVersion)
+		if opts.Track > 0 || opts.HasMinorTrack {
+			track, minor, err := getTrack(baseVersion)
 			if err != nil {
 				continue // Ignore invalid GCS entries for now
 			}
@@ -146,11 +187,25 @@ func (gcs *GCSRepo) matchingVersions(history []string, opts *core.FilterOpts) ([
 			} else if track < opts.Track {
 				break
 			}
+			// Within a track, the minor versions are in descending order, too.
+			if opts.HasMinorTrack {
+				if minor > opts.MinorTrack {
+					continue
+				} else if minor < opts.MinorTrack {
+					break
+				}
+			}
+		}
+		if opts.Constraints != nil {
+			parsed, err := version.NewVersion(baseVersion)
+			if err != nil || !opts.Constraints.Check(parsed) {
+				continue
+			}
 		}
 
 		// Append slash to match directories
 		bucket := fmt.Sprintf("%s/", history[hpos])
-		prefixes, err := listDirectoriesInBucket(bucket)
+		prefixes, err := listDirectoriesInBucket(ctx, bazeliskHome, bucket, listing)
 		if err != nil {
 			return []string{}, fmt.Errorf("could not list LTS releases/candidates: %v", err)
 		}
@@ -172,16 +227,25 @@ func (gcs *GCSRepo) matchingVersions(history []string, opts *core.FilterOpts) ([
 	return descendingMatches, nil
 }
 
-func getTrack(version string) (int, error) {
-	major, _, _ := strings.Cut(version, ".")
-	if val, err := strconv.Atoi(major); err == nil {
-		return val, nil
+// getTrack returns the major and minor version of the given base version.
+func getTrack(version string) (int, int, error) {
+	parts := strings.SplitN(version, ".", 3)
+	if len(parts) < 2 {
+		return 0, 0, fmt.Errorf("invalid version %q", version)
+	}
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid version %q", version)
+	}
+	minor, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid version %q", version)
 	}
-	return 0, fmt.Errorf("invalid version %q", version)
+	return major, minor, nil
 }
 
 // DownloadLTS downloads the given Bazel LTS release (candidate) into the specified location and returns the absolute path.
-func (gcs *GCSRepo) DownloadLTS(version, destDir, destFile string, config config.Config) (string, error) {
+func (gcs *GCSRepo) DownloadLTS(ctx context.Context, version, destDir, destFile string, config config.Config) (string, error) {
 	srcFile, err := platforms.DetermineBazelFilename(version, true, config)
 	if err != nil {
 		return "", err
@@ -196,14 +260,16 @@ func (gcs *GCSRepo) DownloadLTS(version, destDir, destFile string, config config
 	}
 
 	url := fmt.Sprintf("%s/%s/%s/%s", ltsBaseURL, baseVersion, folder, srcFile)
-	return httputil.DownloadBinary(url, destDir, destFile, config)
+	return httputil.DownloadBinary(ctx, url, destDir, destFile, config)
 }
 
 // CommitRepo
 
 // GetLastGreenCommit returns the most recent commit at which a Bazel binary is successfully built.
-func (gcs *GCSRepo) GetLastGreenCommit(bazeliskHome string) (string, error) {
-	content, _, err := httputil.ReadRemoteFile(lastGreenCommitURL, "")
+func (gcs *GCSRepo) GetLastGreenCommit(ctx context.Context, bazeliskHome string) (string, error) {
+	// The last green commit changes frequently, so always check whether it's still up to date.
+	// Thanks to the conditional request, the commit is only downloaded again if it has changed.
+	content, err := httputil.ReadCachedRemoteFile(ctx, bazeliskHome, lastGreenCommitURL, "last_green_commit", 0)
 	if err != nil {
 		return "", fmt.Errorf("could not determine last green commit: %v", err)
 	}
@@ -218,27 +284,29 @@ func (gcs *GCSRepo) GetLastGreenCommit(bazeliskHome string) (string, error) {
 }
 
 // DownloadAtCommit downloads a Bazel binary built at the given commit into the specified location and returns the absolute path.
-func (gcs *GCSRepo) DownloadAtCommit(commit, destDir, destFile string, config config.Config) (string, error) {
+func (gcs *GCSRepo) DownloadAtCommit(ctx context.Context, commit, destDir, destFile string, config config.Config) (string, error) {
 	log.Printf("Using unreleased version at commit %s", commit)
 	platform, err := platforms.GetPlatform()
 	if err != nil {
 		return "", err
 	}
 	url := fmt.Sprintf("%s/%s/%s/bazel", commitBaseURL, platform, commit)
-	return httputil.DownloadBinary(url, destDir, destFile, config)
+	return httputil.DownloadBinary(ctx, url, destDir, destFile, config)
 }
 
 // RollingRepo
 
 // GetRollingVersions returns a list of all available rolling release versions for the newest release.
-func (gcs *GCSRepo) GetRollingVersions(bazeliskHome string) ([]string, error) {
-	history, err := getVersionHistoryFromGCS()
+func (gcs *GCSRepo) GetRollingVersions(ctx context.Context, bazeliskHome string) ([]string, error) {
+	listing := startListing()
+	defer listing.finish()
+	history, err := getVersionHistoryFromGCS(ctx, bazeliskHome, listing)
 	if err != nil {
 		return []string{}, err
 	}
 
 	newest := history[len(history)-1]
-	versions, err := listDirectoriesInBucket(newest + "/rolling/")
+	versions, err := listDirectoriesInBucket(ctx, bazeliskHome, newest+"/rolling/", listing)
 	if err != nil {
 		return []string{}, err
 	}
@@ -254,7 +322,7 @@ func (gcs *GCSRepo) GetRollingVersions(bazeliskHome string) ([]string, error) {
 }
 
 // DownloadRolling downloads the given Bazel version into the specified location and returns the absolute path.
-func (gcs *GCSRepo) DownloadRolling(version, destDir, destFile string, config config.Config) (string, error) {
+func (gcs *GCSRepo) DownloadRolling(ctx context.Context, version, destDir, destFile string, config config.Config) (string, error) {
 	srcFile, err := platforms.DetermineBazelFilename(version, true, config)
 	if err != nil {
 		return "", err
@@ -262,5 +330,5 @@ func (gcs *GCSRepo) DownloadRolling(version, destDir, destFile string, config co
 
 	releaseVersion := strings.Split(version, "-")[0]
 	url := fmt.Sprintf("%s/%s/rolling/%s/%s", ltsBaseURL, releaseVersion, version, srcFile)
-	return httputil.DownloadBinary(url, destDir, destFile, config)
+	return httputil.DownloadBinary(ctx, url, destDir, destFile, config)
 }
@@ -0,0 +1,33 @@
+package repositories
+
+import "testing"
+
+func TestGetTrack(t *testing.T) {
+	tests := []struct {
+		version   string
+		wantMajor int
+		wantMinor int
+	}{
+		{version: "7.3.1", wantMajor: 7, wantMinor: 3},
+		{version: "0.29.1", wantMajor: 0, wantMinor: 29},
+		{version: "7.3.0rc2", wantMajor: 7, wantMinor: 3},
+		{version: "8.0.0-pre.20240101.1", wantMajor: 8, wantMinor: 0},
+	}
+
+	for _, test := range tests {
+		major, minor, err := getTrack(test.version)
+		if err != nil {
+			t.Errorf("getTrack(%q) failed unexpectedly: %v", test.version, err)
+			continue
+		}
+		if major != test.wantMajor || minor != test.wantMinor {
+			t.Errorf("Expected getTrack(%q) to return %d.%d, but got %d.%d", test.version, test.wantMajor, test.wantMinor, major, minor)
+		}
+	}
+
+	for _, version := range []string{"", "7", "x.3.1", "7.y.1"} {
+		if _, _, err := getTrack(version); err == nil {
+			t.Errorf("Expected getTrack(%q) to fail", version)
+		}
+	}
+}
@@ -1,8 +1,14 @@
 package repositories
 
 import (
+	"context"
+	"crypto/sha256"
 	"encoding/json"
 	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
 
 	"github.com/bazelbuild/bazelisk/config"
 	"github.com/bazelbuild/bazelisk/httputil"
@@ -10,40 +16,54 @@ import (
 )
 
 const (
-	urlPattern = "https://github.com/%s/bazel/releases/download/%s/%s"
+	urlPattern        = "https://github.com/%s/bazel/releases/download/%s/%s"
+	releasesURL       = "https://api.github.com/repos/%s/bazel/releases"
+	releaseByTagURL   = "https://api.github.com/repos/%s/bazel/releases/tags/%s"
+	checksumExtension = ".sha256"
 )
 
 // GitHubRepo represents a fork of Bazel hosted on GitHub, and provides a list of all available Bazel binaries in that repo, as well as the ability to download them.
 type GitHubRepo struct {
 	token string
+
+	// releases caches the releases of every fork that has been listed so far, so that downloads can use the asset metadata.
+	releases map[string][]gitHubRelease
 }
 
 // CreateGitHubRepo instantiates a new GitHubRepo.
 func CreateGitHubRepo(token string) *GitHubRepo {
-	return &GitHubRepo{token}
+	return &GitHubRepo{token: token, releases: make(map[string][]gitHubRelease)}
 }
 
 // ForkRepo
 
 // GetVersions returns the versions of all available Bazel binaries in the given fork.
-func (gh *GitHubRepo) GetVersions(bazeliskHome, bazelFork string) ([]string, error) {
-	return gh.getFilteredVersions(bazeliskHome, bazelFork, false)
+func (gh *GitHubRepo) GetVersions(ctx context.Context, bazeliskHome, bazelFork string) ([]string, error) {
+	return gh.getFilteredVersions(ctx, bazeliskHome, bazelFork, false)
 }
 
-func (gh *GitHubRepo) getFilteredVersions(bazeliskHome, bazelFork string, wantPrerelease bool) ([]string, error) {
-	parse := func(data []byte) ([]gitHubRelease, error) {
-		var releases []gitHubRelease
-		if err := json.Unmarshal(data, &releases); err != nil {
-			return nil, fmt.Errorf("could not parse JSON into list of releases: %v", err)
+func (gh *GitHubRepo) getFilteredVersions(ctx context.Context, bazeliskHome, bazelFork string, wantPrerelease bool) ([]string, error) {
+	releases, err := gh.getReleases(ctx, bazeliskHome, bazelFork)
+	if err != nil {
+		return []string{}, err
+	}
+
+	var tags []string
+	for _, release := range releases {
+		if release.Prerelease != wantPrerelease {
+			continue
 		}
-		return releases, nil
+		tags = append(tags, release.TagName)
 	}
+	return tags, nil
+}
 
+func (gh *GitHubRepo) getReleases(ctx context.Context, bazeliskHome, bazelFork string) ([]gitHubRelease, error) {
 	var releases []gitHubRelease
 
 	merger := func(chunks [][]byte) ([]byte, error) {
 		for _, chunk := range chunks {
-			current, err := parse(chunk)
+			current, err := parseReleases(chunk)
 			if err != nil {
 				return nil, err
 			}
@@ -52,44 +72,166 @@ func (gh *GitHubRepo) getFilteredVersions(bazeliskHome, bazelFork string, wantPr
 		return json.Marshal(releases)
 	}
 
-	url := fmt.Sprintf("https://api.github.com/repos/%s/bazel/releases", bazelFork)
-	auth := ""
-	if gh.token != "" {
-		auth = fmt.Sprintf("token %s", gh.token)
-	}
-	releasesJSON, err := httputil.MaybeDownload(bazeliskHome, url, bazelFork+"-releases.json", "list of Bazel releases from github.com/"+bazelFork, auth, merger)
+	url := fmt.Sprintf(releasesURL, bazelFork)
+	releasesJSON, err := httputil.MaybeDownload(ctx, bazeliskHome, url, bazelFork+"-releases.json", "list of Bazel releases from github.com/"+bazelFork, gh.authHeader(), merger)
 	if err != nil {
-		return []string{}, fmt.Errorf("unable to determine '%s' releases: %v", bazelFork, err)
+		return nil, fmt.Errorf("unable to determine '%s' releases: %w", bazelFork, err)
 	}
 
 	if len(releases) == 0 {
-		releases, err = parse(releasesJSON)
+		releases, err = parseReleases(releasesJSON)
 		if err != nil {
 			return nil, err
 		}
 	}
 
-	var tags []string
-	for _, release := range releases {
-		if release.Prerelease != wantPrerelease {
-			continue
-		}
-		tags = append(tags, release.TagName)
+	gh.releases[bazelFork] = releases
+	return releases, nil
+}
+
+func parseReleases(data []byte) ([]gitHubRelease, error) {
+	var releases []gitHubRelease
+	if err := json.Unmarshal(data, &releases); err != nil {
+		return nil, fmt.Errorf("could not parse JSON into list of releases: %v", err)
 	}
-	return tags, nil
+	return releases, nil
+}
+
+func (gh *GitHubRepo) authHeader() string {
+	if gh.token == "" {
+		return ""
+	}
+	return fmt.Sprintf("token %s", gh.token)
 }
 
 type gitHubRelease struct {
-	TagName    string `json:"tag_name"`
-	Prerelease bool   `json:"prerelease"`
+	TagName    string        `json:"tag_name"`
+	Prerelease bool          `json:"prerelease"`
+	Assets     []gitHubAsset `json:"assets"`
+}
+
+type gitHubAsset struct {
+	Name string `json:"name"`
+	// URL points to the asset API endpoint, which also works for private repositories.
+	URL string `json:"url"`
+}
+
+func (r *gitHubRelease) findAsset(name string) *gitHubAsset {
+	for i := range r.Assets {
+		if r.Assets[i].Name == name {
+			return &r.Assets[i]
+		}
+	}
+	return nil
+}
+
+// findRelease returns the release with the given tag, preferring previously listed releases over a new API request.
+func (gh *GitHubRepo) findRelease(ctx context.Context, fork, version string) (*gitHubRelease, error) {
+	for i, release := range gh.releases[fork] {
+		if release.TagName == version {
+			return &gh.releases[fork][i], nil
+		}
+	}
+
+	url := fmt.Sprintf(releaseByTagURL, fork, version)
+	content, _, err := httputil.ReadRemoteFile(ctx, url, gh.authHeader())
+	if err != nil {
+		return nil, err
+	}
+	var release gitHubRelease
+	if err := json.Unmarshal(content, &release); err != nil {
+		return nil, fmt.Errorf("could not parse JSON of release %s: %v", version, err)
+	}
+	return &release, nil
 }
 
 // DownloadVersion downloads a Bazel binary for the given version and fork to the specified location and returns the absolute path.
-func (gh *GitHubRepo) DownloadVersion(fork, version, destDir, destFile string, config config.Config) (string, error) {
+// If the release metadata lists the binary as an asset, it is downloaded via the GitHub asset API and verified against an accompanying ".sha256" asset, if present.
+func (gh *GitHubRepo) DownloadVersion(ctx context.Context, fork, version, destDir, destFile string, config config.Config) (string, error) {
 	filename, err := platforms.DetermineBazelFilename(version, true, config)
 	if err != nil {
 		return "", err
 	}
-	url := fmt.Sprintf(urlPattern, fork, version, filename)
-	return httputil.DownloadBinary(url, destDir, destFile, config)
+
+	release, err := gh.findRelease(ctx, fork, version)
+	if err != nil {
+		log.Printf("Could not fetch metadata of release %s in %s, falling back to the default download URL: %v", version, fork, err)
+	}
+	var asset *gitHubAsset
+	if release != nil {
+		asset = release.findAsset(filename)
+	}
+	if asset == nil {
+		// Releases cached by older Bazelisk versions do not contain any assets.
+		url := fmt.Sprintf(urlPattern, fork, version, filename)
+		headers, err := httputil.DownloadHeaders(ctx, url, gh.authHeader(), config)
+		if err != nil {
+			return "", err
+		}
+		return httputil.DownloadBinaryWithHeaders(ctx, url, destDir, destFile, headers, config)
+	}
+
+	headers, err := gh.assetHeaders(ctx, asset.URL, config)
+	if err != nil {
+		return "", err
+	}
+	path, err := httputil.DownloadBinaryWithHeaders(ctx, asset.URL, destDir, destFile, headers, config)
+	if err != nil {
+		return "", err
+	}
+
+	checksumAsset := release.findAsset(filename + checksumExtension)
+	if checksumAsset == nil {
+		return path, nil
+	}
+	checksumHeaders, err := gh.assetHeaders(ctx, checksumAsset.URL, config)
+	if err != nil {
+		os.Remove(path)
+		return "", err
+	}
+	content, _, err := httputil.ReadRemoteFileWithHeaders(ctx, checksumAsset.URL, checksumHeaders)
+	if err != nil {
+		os.Remove(path)
+		return "", fmt.Errorf("could not download checksum of %s: %v", filename, err)
+	}
+	if err := verifySha256(path, content); err != nil {
+		os.Remove(path)
+		return "", err
+	}
+	return path, nil
+}
+
+// assetHeaders returns the headers for a request to the GitHub asset API, which requires the token for private forks.
+func (gh *GitHubRepo) assetHeaders(ctx context.Context, url string, config config.Config) (map[string]string, error) {
+	headers, err := httputil.DownloadHeaders(ctx, url, gh.authHeader(), config)
+	if err != nil {
+		return nil, err
+	}
+	headers["Accept"] = "application/octet-stream"
+	return headers, nil
+}
+
+// verifySha256 checks that the file at the given path matches the checksum file content ("<hex digest>  <file name>").
+func verifySha256(path string, checksumFile []byte) error {
+	fields := strings.Fields(string(checksumFile))
+	if len(fields) == 0 {
+		return fmt.Errorf("checksum file for %s is empty", path)
+	}
+	expected := strings.ToLower(fields[0])
+
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("could not open %s to verify its checksum: %v", path, err)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return fmt.Errorf("could not compute sha256 of %s: %v", path, err)
+	}
+	actual := fmt.Sprintf("%x", h.Sum(nil))
+	if actual != expected {
+		return fmt.Errorf("%s has sha256=%s but the release lists sha256=%s", path, actual, expected)
+	}
+	return nil
 }
@@ -7,6 +7,8 @@ import (
 	"regexp"
 	"sort"
 	"strconv"
+	"strings"
+	"unicode"
 
 	"github.com/hashicorp/go-version"
 )
@@ -18,12 +20,14 @@ const (
 
 var (
 	releasePattern       = regexp.MustCompile(`^(\d+)\.\d+\.\d+$`)
-	trackPattern         = regexp.MustCompile(`^(\d+)\.(x|\*)$`)
+	trackPattern         = regexp.MustCompile(`^(\d+)(?:\.(\d+))?\.(x|\*)$`)
 	patchPattern         = regexp.MustCompile(`^(\d+\.\d+\.\d+)-([\w\d]+)$`)
 	candidatePattern     = regexp.MustCompile(`^(\d+\.\d+\.\d+)rc(\d+)$`)
 	rollingPattern       = regexp.MustCompile(`^\d+\.0\.0-pre\.\d{8}(\.\d+){1,2}$`)
 	latestReleasePattern = regexp.MustCompile(`^latest(?:-(?P<offset>\d+))?$`)
 	commitPattern        = regexp.MustCompile(`^[a-z0-9]{40}$`)
+	// shortVersionPattern matches the versions in "~" and "^" constraints, which may omit the minor and patch numbers.
+	shortVersionPattern = regexp.MustCompile(`^\d+(\.\d+){0,2}$`)
 )
 
 // Info represents a structured Bazel version identifier.
@@ -33,6 +37,11 @@ type Info struct {
 	IsCommit, IsFork, IsRelative   bool
 	Fork, Value                    string
 	LatestOffset, TrackRestriction int
+	// HasMinorTrack is true for minor tracks such as "7.3.x", which restrict the version to MinorTrackRestriction.
+	HasMinorTrack         bool
+	MinorTrackRestriction int
+	// Constraints restricts the version to releases that satisfy them, e.g. ">=7.1.0 <8".
+	Constraints version.Constraints
 }
 
 // Parse extracts and returns structured information about the given Bazel version label.
@@ -45,10 +54,18 @@ func Parse(fork, version string) (*Info, error) {
 	} else if m := trackPattern.FindStringSubmatch(version); m != nil {
 		track, err := strconv.Atoi(m[1])
 		if err != nil {
-			return nil, fmt.Errorf("invalid version %q, expected something like '5.x' or '5.*'", version)
+			return nil, fmt.Errorf("invalid version %q, expected something like '5.x', '5.*', '5.3.x' or '5.3.*'", version)
+		}
+		if m[2] != "" {
+			minor, err := strconv.Atoi(m[2])
+			if err != nil {
+				return nil, fmt.Errorf("invalid version %q, expected something like '5.x', '5.*', '5.3.x' or '5.3.*'", version)
+			}
+			vi.HasMinorTrack = true
+			vi.MinorTrackRestriction = minor
 		}
 		vi.IsLTS = true
-		vi.MustBeRelease = (m[2] == "x")
+		vi.MustBeRelease = (m[3] == "x")
 		vi.IsRelative = true
 		vi.TrackRestriction = track
 	} else if patchPattern.MatchString(version) {
@@ -82,12 +99,100 @@ func Parse(fork, version string) (*Info, error) {
 	} else if version == "rolling" {
 		vi.IsRolling = true
 		vi.IsRelative = true
+	} else if IsConstraint(version) {
+		constraints, err := parseConstraints(version)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version constraint %q: %v", version, err)
+		}
+		vi.IsLTS = true
+		vi.MustBeRelease = true
+		vi.IsRelative = true
+		vi.Constraints = constraints
 	} else {
 		return nil, fmt.Errorf("invalid version '%s'", version)
 	}
 	return vi, nil
 }
 
+// IsConstraint returns whether the given version label is a version constraint such as ">=7.1.0 <8", "~7.2" or "^6.4".
+func IsConstraint(label string) bool {
+	return strings.IndexAny(label, "<>=!~^") == 0
+}
+
+// parseConstraints parses constraints that are separated by whitespace or commas. Besides the operators of
+// go-version, it supports "~X.Y[.Z]", which allows newer patch releases, and "^X[.Y[.Z]]", which allows newer
+// minor and patch releases, like npm and Cargo.
+func parseConstraints(label string) (version.Constraints, error) {
+	var clauses []string
+	fields := strings.FieldsFunc(label, func(r rune) bool { return r == ',' || unicode.IsSpace(r) })
+	for i := 0; i < len(fields); i++ {
+		clause := fields[i]
+		// Allow whitespace between an operator and its version, e.g. ">= 7.1.0".
+		if strings.Trim(clause, "<>=!~^") == "" && i+1 < len(fields) {
+			i++
+			clause += fields[i]
+		}
+		switch {
+		case strings.HasPrefix(clause, "^"):
+			expanded, err := expandRange(clause[1:], true)
+			if err != nil {
+				return nil, err
+			}
+			clauses = append(clauses, expanded...)
+		case strings.HasPrefix(clause, "~") && !strings.HasPrefix(clause, "~>"):
+			expanded, err := expandRange(clause[1:], false)
+			if err != nil {
+				return nil, err
+			}
+			clauses = append(clauses, expanded...)
+		default:
+			clauses = append(clauses, clause)
+		}
+	}
+	if len(clauses) == 0 {
+		return nil, fmt.Errorf("no constraints")
+	}
+	return version.NewConstraint(strings.Join(clauses, ","))
+}
+
+// expandRange returns the lower and upper bound of a "^" (caret) or "~" (tilde) constraint on the given version.
+func expandRange(v string, caret bool) ([]string, error) {
+	if !shortVersionPattern.MatchString(v) {
+		return nil, fmt.Errorf("invalid version %q, expected something like 7, 7.2 or 7.2.1", v)
+	}
+	var segments [3]int
+	parts := strings.Split(v, ".")
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version %q: %v", v, err)
+		}
+		segments[i] = n
+	}
+
+	// The upper bound increments the segment that must not change: the major version for "~7" and for "^" unless the
+	// version starts with zeros, in which case it's the first non-zero segment. "~" otherwise allows patch releases.
+	bump := 1
+	if len(parts) == 1 {
+		bump = 0
+	}
+	if caret {
+		bump = 0
+		for bump < len(parts)-1 && segments[bump] == 0 {
+			bump++
+		}
+	}
+	upper := segments
+	upper[bump]++
+	for i := bump + 1; i < len(upper); i++ {
+		upper[i] = 0
+	}
+	return []string{
+		fmt.Sprintf(">=%d.%d.%d", segments[0], segments[1], segments[2]),
+		fmt.Sprintf("<%d.%d.%d", upper[0], upper[1], upper[2]),
+	}, nil
+}
+
 func isFork(value string) bool {
 	return value != "" && value != BazelUpstream
 }
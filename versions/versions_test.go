@@ -0,0 +1,122 @@
+package versions
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/hashicorp/go-version"
+)
+
+func TestParseTracks(t *testing.T) {
+	tests := []struct {
+		label             string
+		wantMustBeRelease bool
+		wantTrack         int
+		wantHasMinorTrack bool
+		wantMinorTrack    int
+	}{
+		{label: "7.x", wantMustBeRelease: true, wantTrack: 7},
+		{label: "7.*", wantTrack: 7},
+		{label: "7.3.x", wantMustBeRelease: true, wantTrack: 7, wantHasMinorTrack: true, wantMinorTrack: 3},
+		{label: "7.3.*", wantTrack: 7, wantHasMinorTrack: true, wantMinorTrack: 3},
+		{label: "0.0.x", wantMustBeRelease: true, wantHasMinorTrack: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.label, func(t *testing.T) {
+			vi, err := Parse(BazelUpstream, test.label)
+			if err != nil {
+				t.Fatalf("Parse(%q) failed unexpectedly: %v", test.label, err)
+			}
+			if !vi.IsRelative {
+				t.Errorf("Expected %q to be relative", test.label)
+			}
+			if vi.MustBeRelease != test.wantMustBeRelease {
+				t.Errorf("Expected MustBeRelease %t, but got %t", test.wantMustBeRelease, vi.MustBeRelease)
+			}
+			if vi.TrackRestriction != test.wantTrack {
+				t.Errorf("Expected track %d, but got %d", test.wantTrack, vi.TrackRestriction)
+			}
+			if vi.HasMinorTrack != test.wantHasMinorTrack || vi.MinorTrackRestriction != test.wantMinorTrack {
+				t.Errorf("Expected minor track %t/%d, but got %t/%d", test.wantHasMinorTrack, test.wantMinorTrack, vi.HasMinorTrack, vi.MinorTrackRestriction)
+			}
+		})
+	}
+}
+
+func TestParseConstraints(t *testing.T) {
+	tests := []struct {
+		label     string
+		matches   []string
+		noMatches []string
+	}{
+		{label: ">=7.1.0 <8", matches: []string{"7.1.0", "7.4.1"}, noMatches: []string{"7.0.0", "8.0.0"}},
+		{label: ">= 6.4, < 7", matches: []string{"6.4.0", "6.5.0"}, noMatches: []string{"6.3.2", "7.0.0"}},
+		{label: "~7.2", matches: []string{"7.2.0", "7.2.3"}, noMatches: []string{"7.1.9", "7.3.0"}},
+		{label: "~7", matches: []string{"7.0.0", "7.9.1"}, noMatches: []string{"6.5.0", "8.0.0"}},
+		{label: "~>4.1.0", matches: []string{"4.1.0", "4.1.2"}, noMatches: []string{"4.0.0", "4.2.0"}},
+		{label: "^6.4", matches: []string{"6.4.0", "6.9.0"}, noMatches: []string{"6.3.0", "7.0.0"}},
+		{label: "^0.2.3", matches: []string{"0.2.3", "0.2.9"}, noMatches: []string{"0.2.2", "0.3.0"}},
+		{label: "^0.0", matches: []string{"0.0.0", "0.0.5"}, noMatches: []string{"0.1.0"}},
+		{label: "!=7.0.0", matches: []string{"6.0.0", "7.0.1"}, noMatches: []string{"7.0.0"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.label, func(t *testing.T) {
+			vi, err := Parse(BazelUpstream, test.label)
+			if err != nil {
+				t.Fatalf("Parse(%q) failed unexpectedly: %v", test.label, err)
+			}
+			if !vi.IsRelative || !vi.MustBeRelease || vi.Constraints == nil {
+				t.Fatalf("Expected %q to be a relative release constraint, but got %+v", test.label, vi)
+			}
+			for _, v := range test.matches {
+				if !vi.Constraints.Check(version.Must(version.NewVersion(v))) {
+					t.Errorf("Expected %s to satisfy %q", v, test.label)
+				}
+			}
+			for _, v := range test.noMatches {
+				if vi.Constraints.Check(version.Must(version.NewVersion(v))) {
+					t.Errorf("Expected %s not to satisfy %q", v, test.label)
+				}
+			}
+		})
+	}
+}
+
+func TestParseInvalidVersions(t *testing.T) {
+	for _, label := range []string{"", "7", "7.3", "x.3.x", "7.3.x.x", ">=", "~", "^", "~7.x", "^7.2.3.4", ">=7.1.0 <"} {
+		if _, err := Parse(BazelUpstream, label); err == nil {
+			t.Errorf("Expected Parse(%q) to fail", label)
+		}
+	}
+}
+
+func TestExpandRange(t *testing.T) {
+	tests := []struct {
+		version string
+		caret   bool
+		want    []string
+	}{
+		{version: "7", want: []string{">=7.0.0", "<8.0.0"}},
+		{version: "7.2", want: []string{">=7.2.0", "<7.3.0"}},
+		{version: "7.2.1", want: []string{">=7.2.1", "<7.3.0"}},
+		{version: "7", caret: true, want: []string{">=7.0.0", "<8.0.0"}},
+		{version: "7.2.1", caret: true, want: []string{">=7.2.1", "<8.0.0"}},
+		{version: "0.2.3", caret: true, want: []string{">=0.2.3", "<0.3.0"}},
+		{version: "0.0.3", caret: true, want: []string{">=0.0.3", "<0.0.4"}},
+		{version: "0.0", caret: true, want: []string{">=0.0.0", "<0.1.0"}},
+		{version: "0", caret: true, want: []string{">=0.0.0", "<1.0.0"}},
+	}
+
+	for _, test := range tests {
+		got, err := expandRange(test.version, test.caret)
+		if err != nil {
+			t.Errorf("expandRange(%q, %t) failed unexpectedly: %v", test.version, test.caret, err)
+			continue
+		}
+		if !slices.Equal(got, test.want) {
+			t.Errorf("Expected expandRange(%q, %t) to return %v, but got %v", test.version, test.caret, test.want, got)
+		}
+	}
+}